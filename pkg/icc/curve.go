@@ -0,0 +1,134 @@
+package icc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// curve maps a normalized value in [0, 1] to another
+type curve func(float64) float64
+
+// identity is the curve that leaves values unchanged
+func identity(v float64) float64 { return v }
+
+// readCurve decodes a curveType or parametricCurveType element and returns it
+// with the number of bytes it takes, excluding padding
+func readCurve(data []byte) (curve, int, error) {
+	if len(data) < 12 {
+		return nil, 0, fmt.Errorf("icc: curve is truncated")
+	}
+
+	switch string(data[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(data[8:]))
+		size := 12 + 2*n
+		if n < 0 || size > len(data) {
+			return nil, 0, fmt.Errorf("icc: curve is truncated")
+		}
+		switch n {
+		case 0:
+			return identity, size, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(data[12:])) / 256
+			return func(v float64) float64 { return math.Pow(clamp01(v), gamma) }, size, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(data[12+2*i:])) / 65535
+		}
+		return sampledCurve(table), size, nil
+
+	case "para":
+		// Number of parameters of each function type
+		counts := [...]int{1, 3, 4, 5, 7}
+		kind := int(binary.BigEndian.Uint16(data[8:]))
+		if kind >= len(counts) {
+			return nil, 0, fmt.Errorf("icc: unknown parametric curve type %d", kind)
+		}
+		size := 12 + 4*counts[kind]
+		if size > len(data) {
+			return nil, 0, fmt.Errorf("icc: curve is truncated")
+		}
+		var params [7]float64
+		for i := 0; i < counts[kind]; i++ {
+			params[i] = s15Fixed16(data[12+4*i:])
+		}
+		return parametricCurve(kind, params), size, nil
+	}
+
+	return nil, 0, fmt.Errorf("icc: unknown curve type %q", data[:4])
+}
+
+// sampledCurve interpolates linearly between evenly spaced samples
+func sampledCurve(table []float64) curve {
+	last := len(table) - 1
+	return func(v float64) float64 {
+		pos := clamp01(v) * float64(last)
+		i := min(int(pos), last-1)
+		frac := pos - float64(i)
+		return table[i] + (table[i+1]-table[i])*frac
+	}
+}
+
+// parametricCurve builds one of the five parametric functions
+func parametricCurve(kind int, p [7]float64) curve {
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	pow := func(x float64) float64 {
+		if x <= 0 {
+			return 0
+		}
+		return math.Pow(x, g)
+	}
+
+	switch kind {
+	case 1:
+		return func(x float64) float64 {
+			if a == 0 || x < -b/a {
+				return 0
+			}
+			return pow(a*x + b)
+		}
+	case 2:
+		return func(x float64) float64 {
+			if a == 0 || x < -b/a {
+				return c
+			}
+			return pow(a*x+b) + c
+		}
+	case 3:
+		return func(x float64) float64 {
+			if x < d {
+				return c * x
+			}
+			return pow(a*x + b)
+		}
+	case 4:
+		return func(x float64) float64 {
+			if x < d {
+				return c*x + f
+			}
+			return pow(a*x+b) + e
+		}
+	}
+	return pow
+}
+
+// readCurves reads n consecutive curves, each padded to a multiple of four
+// bytes
+func readCurves(data []byte, n int) ([]curve, error) {
+	curves := make([]curve, n)
+	offset := 0
+	for i := range curves {
+		if offset > len(data) {
+			return nil, fmt.Errorf("icc: curve %d is truncated", i)
+		}
+		c, size, err := readCurve(data[offset:])
+		if err != nil {
+			return nil, err
+		}
+		curves[i] = c
+		offset += (size + 3) &^ 3
+	}
+	return curves, nil
+}
@@ -0,0 +1,225 @@
+// Package icc reads ICC color profiles and converts images described by them
+// to sRGB.
+//
+// RGB profiles built from primaries and tone curves (matrix/TRC), gray
+// profiles and LUT-based profiles (lut8, lut16 and lutAtoB, as used by CMYK
+// profiles) are supported. The perceptual rendering intent is used.
+//
+// The profile format is described at https://www.color.org/specification/ICC.1-2022-05.pdf
+package icc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Color space signatures
+const (
+	ColorSpaceRGB  = "RGB "
+	ColorSpaceCMYK = "CMYK"
+	ColorSpaceGray = "GRAY"
+)
+
+// Profile connection space signatures
+const (
+	pcsXYZ = "XYZ "
+	pcsLab = "Lab "
+)
+
+// headerSize is the size of the fixed profile header before the tag table
+const headerSize = 128
+
+// d50 is the PCS illuminant
+var d50 = [3]float64{0.9642, 1, 0.8249}
+
+// Profile is a parsed ICC profile, reduced to the transform from its color
+// space to PCS XYZ
+type Profile struct {
+	ColorSpace  string // RGB, CMYK or GRAY signature
+	Description string
+
+	// Matrix/TRC transform
+	trc    []curve
+	matrix [3][3]float64 // columns are the red, green and blue colorants
+
+	// LUT transform, used when there is no matrix/TRC transform
+	lut *lut
+}
+
+// Parse decodes the header and the tags an ICC profile needs to convert to
+// the PCS
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < headerSize+4 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("icc: not an ICC profile")
+	}
+	p := &Profile{ColorSpace: string(data[16:20])}
+	pcs := string(data[20:24])
+	if pcs != pcsXYZ && pcs != pcsLab {
+		return nil, fmt.Errorf("icc: unsupported connection space %q", pcs)
+	}
+
+	tags, err := readTagTable(data)
+	if err != nil {
+		return nil, err
+	}
+	if desc, ok := tags["desc"]; ok {
+		p.Description = readDescription(desc)
+	}
+
+	switch p.ColorSpace {
+	case ColorSpaceRGB:
+		if err := p.readMatrixTRC(tags); err == nil {
+			return p, nil
+		}
+		p.trc = nil
+	case ColorSpaceGray:
+		if kTRC, ok := tags["kTRC"]; ok {
+			c, _, err := readCurve(kTRC)
+			if err != nil {
+				return nil, fmt.Errorf("icc: gray tone curve: %w", err)
+			}
+			p.trc = []curve{c}
+			return p, nil
+		}
+	case ColorSpaceCMYK:
+	default:
+		return nil, fmt.Errorf("icc: unsupported color space %q", p.ColorSpace)
+	}
+
+	a2b, ok := tags["A2B0"]
+	if !ok {
+		return nil, fmt.Errorf("icc: %s profile has no usable transform", p.ColorSpace)
+	}
+	p.lut, err = readLUT(a2b, pcs)
+	if err != nil {
+		return nil, fmt.Errorf("icc: A2B0: %w", err)
+	}
+	if want := channels(p.ColorSpace); p.lut.inputs != want {
+		return nil, fmt.Errorf("icc: A2B0 has %d inputs, expected %d", p.lut.inputs, want)
+	}
+	return p, nil
+}
+
+// readTagTable returns the data of every tag, keyed by signature
+func readTagTable(data []byte) (map[string][]byte, error) {
+	count := int(binary.BigEndian.Uint32(data[headerSize:]))
+	if count < 0 || headerSize+4+count*12 > len(data) {
+		return nil, fmt.Errorf("icc: tag table is truncated")
+	}
+	tags := make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		entry := data[headerSize+4+i*12:]
+		offset := int64(binary.BigEndian.Uint32(entry[4:]))
+		size := int64(binary.BigEndian.Uint32(entry[8:]))
+		if offset+size > int64(len(data)) {
+			continue
+		}
+		tags[string(entry[:4])] = data[offset : offset+size]
+	}
+	return tags, nil
+}
+
+// readMatrixTRC reads the colorant and tone curve tags of an RGB profile
+func (p *Profile) readMatrixTRC(tags map[string][]byte) error {
+	for i, name := range []string{"r", "g", "b"} {
+		xyz, ok := tags[name+"XYZ"]
+		if !ok {
+			return fmt.Errorf("icc: missing %sXYZ", name)
+		}
+		col, err := readXYZ(xyz)
+		if err != nil {
+			return err
+		}
+		for row := range col {
+			p.matrix[row][i] = col[row]
+		}
+
+		trc, ok := tags[name+"TRC"]
+		if !ok {
+			return fmt.Errorf("icc: missing %sTRC", name)
+		}
+		c, _, err := readCurve(trc)
+		if err != nil {
+			return err
+		}
+		p.trc = append(p.trc, c)
+	}
+	return nil
+}
+
+// readXYZ decodes an XYZType tag with a single value
+func readXYZ(data []byte) ([3]float64, error) {
+	if len(data) < 20 || string(data[:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("icc: invalid XYZ tag")
+	}
+	return [3]float64{s15Fixed16(data[8:]), s15Fixed16(data[12:]), s15Fixed16(data[16:])}, nil
+}
+
+// readDescription returns the text of a textDescriptionType (v2) or
+// multiLocalizedUnicodeType (v4) tag
+func readDescription(data []byte) string {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "desc":
+		n := int(binary.BigEndian.Uint32(data[8:]))
+		if n <= 0 || 12+n > len(data) {
+			return ""
+		}
+		text := data[12 : 12+n]
+		for len(text) > 0 && text[len(text)-1] == 0 {
+			text = text[:len(text)-1]
+		}
+		return string(text)
+	case len(data) >= 28 && string(data[:4]) == "mluc":
+		// The first record is enough; it is usually English
+		size := int(binary.BigEndian.Uint32(data[20:]))
+		offset := int(binary.BigEndian.Uint32(data[24:]))
+		if size < 0 || offset < 0 || offset+size > len(data) {
+			return ""
+		}
+		runes := make([]rune, 0, size/2)
+		for i := offset; i+1 < offset+size; i += 2 {
+			runes = append(runes, rune(binary.BigEndian.Uint16(data[i:])))
+		}
+		return string(runes)
+	}
+	return ""
+}
+
+// channels is the number of components of a color space
+func channels(colorSpace string) int {
+	switch colorSpace {
+	case ColorSpaceCMYK:
+		return 4
+	case ColorSpaceGray:
+		return 1
+	}
+	return 3
+}
+
+// s15Fixed16 decodes a signed 15.16 fixed point number
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// labToXYZ converts CIELAB relative to D50 to XYZ
+func labToXYZ(l, a, b float64) [3]float64 {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	return [3]float64{d50[0] * finv(fx), d50[1] * finv(fy), d50[2] * finv(fz)}
+}
+
+// clamp01 limits v to [0, 1], mapping NaN to 0
+func clamp01(v float64) float64 {
+	if !(v > 0) {
+		return 0
+	}
+	return math.Min(v, 1)
+}
@@ -0,0 +1,229 @@
+package icc
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// testTag is a tag signature and its data for building test profiles
+type testTag struct {
+	sig  string
+	data []byte
+}
+
+// buildProfile lays out a profile header, tag table and tag data
+func buildProfile(colorSpace, pcs string, tags ...testTag) []byte {
+	dataStart := headerSize + 4 + 12*len(tags)
+	var body []byte
+	var table []byte
+	table = binary.BigEndian.AppendUint32(table, uint32(len(tags)))
+	for _, t := range tags {
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(dataStart+len(body)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+		body = append(body, t.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header, uint32(dataStart+len(body)))
+	binary.BigEndian.PutUint32(header[8:], 0x04300000)
+	copy(header[16:], colorSpace)
+	copy(header[20:], pcs)
+	copy(header[36:], "acsp")
+
+	out := append(header, table...)
+	return append(out, body...)
+}
+
+// srgbParaCurve is the sRGB tone curve as a parametricCurveType
+func srgbParaCurve() []byte {
+	out := []byte("para\x00\x00\x00\x00")
+	out = binary.BigEndian.AppendUint16(out, 3)
+	out = append(out, 0, 0)
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		out = binary.BigEndian.AppendUint32(out, uint32(int32(math.Round(v*65536))))
+	}
+	return out
+}
+
+// displayP3 is a matrix/TRC profile with the Display P3 primaries, as
+// adapted to D50 in Apple's profile, and the sRGB tone curve
+func displayP3() []byte {
+	return buildProfile(ColorSpaceRGB, pcsXYZ,
+		testTag{"rXYZ", xyzTag([3]float64{0.51512, 0.24120, -0.00105})},
+		testTag{"gXYZ", xyzTag([3]float64{0.29198, 0.69225, 0.04189})},
+		testTag{"bXYZ", xyzTag([3]float64{0.15710, 0.06657, 0.78407})},
+		testTag{"rTRC", srgbParaCurve()},
+		testTag{"gTRC", srgbParaCurve()},
+		testTag{"bTRC", srgbParaCurve()},
+	)
+}
+
+func TestParseSRGB(t *testing.T) {
+	p, err := Parse(SRGB())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if p.ColorSpace != ColorSpaceRGB || p.Description != "sRGB IEC61966-2.1" {
+		t.Errorf("parsed %q %q", p.ColorSpace, p.Description)
+	}
+	if !p.IsSRGB() {
+		t.Errorf("IsSRGB is false for the built-in sRGB profile")
+	}
+	if size := binary.BigEndian.Uint32(SRGB()); int(size) != len(SRGB()) {
+		t.Errorf("header size is %d, want %d", size, len(SRGB()))
+	}
+
+	// Converting sRGB to sRGB must leave the pixels alone
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{uint8(x), uint8(255 - x), uint8(x * 3), uint8(x)})
+	}
+	out, err := p.ToSRGB(img)
+	if err != nil {
+		t.Fatalf("ToSRGB: %v", err)
+	}
+	for x := 0; x < 256; x++ {
+		assertColor(t, out.NRGBAAt(x, 0), img.NRGBAAt(x, 0), 1)
+	}
+}
+
+func TestDisplayP3ToSRGB(t *testing.T) {
+	p, err := Parse(displayP3())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if p.IsSRGB() {
+		t.Fatalf("IsSRGB is true for Display P3")
+	}
+
+	// The expected colors go through the published D65 Display P3 to sRGB
+	// matrix rather than the D50 connection space
+	p3ToSRGB := [3][3]float64{
+		{1.2249401, -0.2249404, 0},
+		{-0.0420569, 1.0420571, 0},
+		{-0.0196376, -0.0786361, 1.0982735},
+	}
+	expected := func(c color.NRGBA) color.NRGBA {
+		in := [3]float64{srgbToLinear(float64(c.R) / 255), srgbToLinear(float64(c.G) / 255), srgbToLinear(float64(c.B) / 255)}
+		var out [3]uint8
+		for i, row := range p3ToSRGB {
+			v := clamp01(row[0]*in[0] + row[1]*in[1] + row[2]*in[2])
+			out[i] = uint8(math.Round(srgbFromLinear(v) * 255))
+		}
+		return color.NRGBA{out[0], out[1], out[2], c.A}
+	}
+
+	colors := []color.NRGBA{
+		{200, 150, 100, 255},
+		{40, 180, 90, 255},
+		{90, 60, 220, 128},
+		{128, 128, 128, 255},
+		{255, 255, 255, 255},
+		{255, 0, 0, 255}, // outside sRGB, clipped
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, len(colors), 1))
+	for x, c := range colors {
+		img.SetNRGBA(x, 0, c)
+	}
+	out, err := p.ToSRGB(img)
+	if err != nil {
+		t.Fatalf("ToSRGB: %v", err)
+	}
+	for x, c := range colors {
+		assertColor(t, out.NRGBAAt(x, 0), expected(c), 2)
+	}
+
+	// The same color needs a larger red value in the smaller sRGB gamut
+	if got := out.NRGBAAt(0, 0); got.R <= 200 {
+		t.Errorf("P3 %v converted to %v, expected a more saturated sRGB red", colors[0], got)
+	}
+}
+
+func TestCMYKLUTToSRGB(t *testing.T) {
+	// An lut8 that only looks at black: L* falls linearly with K, a* and b*
+	// stay neutral
+	const grid = 2
+	clut := make([]byte, 0, 16*3)
+	for i := 0; i < 16; i++ {
+		k := i & 1 // the last input varies fastest
+		clut = append(clut, byte(255*(1-k)), 128, 128)
+	}
+	profile := buildProfile(ColorSpaceCMYK, pcsLab, testTag{"A2B0", lut8(4, grid, clut)})
+
+	p, err := Parse(profile)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	img := image.NewCMYK(image.Rect(0, 0, 3, 1))
+	img.SetCMYK(0, 0, color.CMYK{})
+	img.SetCMYK(1, 0, color.CMYK{C: 80, M: 80, Y: 80, K: 128})
+	img.SetCMYK(2, 0, color.CMYK{K: 255})
+
+	out, err := p.ToSRGB(img)
+	if err != nil {
+		t.Fatalf("ToSRGB: %v", err)
+	}
+	// L* 50 is sRGB 119 gray
+	for x, want := range []color.NRGBA{{255, 255, 255, 255}, {119, 119, 119, 255}, {0, 0, 0, 255}} {
+		assertColor(t, out.NRGBAAt(x, 0), want, 1)
+	}
+
+	if _, err := p.ToSRGB(image.NewNRGBA(image.Rect(0, 0, 1, 1))); err == nil {
+		t.Errorf("ToSRGB accepted an RGB image for a CMYK profile")
+	}
+}
+
+func TestParseGray(t *testing.T) {
+	gamma := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33") // gamma 2.2
+	p, err := Parse(buildProfile(ColorSpaceGray, pcsXYZ, testTag{"kTRC", gamma}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.SetGray(0, 0, color.Gray{Y: 128})
+	out, err := p.ToSRGB(img)
+	if err != nil {
+		t.Fatalf("ToSRGB: %v", err)
+	}
+	// Gamma 2.2 and the sRGB curve nearly agree in the midtones
+	assertColor(t, out.NRGBAAt(0, 0), color.NRGBA{128, 128, 128, 255}, 3)
+}
+
+func TestParseRejects(t *testing.T) {
+	valid := SRGB()
+	unsigned := append([]byte(nil), valid...)
+	copy(unsigned[36:], "xxxx")
+	tests := map[string][]byte{
+		"empty":             nil,
+		"header only":       valid[:headerSize],
+		"no signature":      unsigned,
+		"truncated table":   valid[:headerSize+4+20],
+		"truncated tags":    valid[:len(valid)/2],
+		"unsupported space": buildProfile("YCbr", pcsXYZ),
+		"unsupported pcs":   buildProfile(ColorSpaceRGB, "Luv "),
+		"cmyk without lut":  buildProfile(ColorSpaceCMYK, pcsLab),
+	}
+	for name, data := range tests {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+}
+
+// assertColor fails if any channel differs by more than tolerance
+func assertColor(t *testing.T, got, want color.NRGBA, tolerance int) {
+	t.Helper()
+	for i, pair := range [][2]uint8{{got.R, want.R}, {got.G, want.G}, {got.B, want.B}, {got.A, want.A}} {
+		if d := int(pair[0]) - int(pair[1]); d > tolerance || d < -tolerance {
+			t.Errorf("channel %d of %v differs from %v by more than %d", i, got, want, tolerance)
+			return
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package icc
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxLUTInputs is the most input channels a LUT is interpolated over
+const maxLUTInputs = 8
+
+// maxCLUTEntries bounds the size of a color lookup table
+const maxCLUTEntries = 1 << 24
+
+// lut is a device to PCS transform: input curves, a color lookup table,
+// optional curves and matrix, and output curves, applied in that order
+type lut struct {
+	inputs, outputs int
+	aCurves         []curve // input curves
+	clut            *clut
+	mCurves         []curve      // lutAtoBType only, before the matrix
+	matrix          *[12]float64 // lutAtoBType only, 3x3 followed by offsets
+	bCurves         []curve      // output curves
+	decodePCS       func(v [3]float64) [3]float64
+}
+
+// clut is a multidimensional table of normalized output values
+type clut struct {
+	grid    []int
+	outputs int
+	data    []float64
+}
+
+// readLUT decodes an lut8Type, lut16Type or lutAtoBType tag with three
+// outputs in the given PCS
+func readLUT(data []byte, pcs string) (*lut, error) {
+	if len(data) < 32 {
+		return nil, fmt.Errorf("LUT is truncated")
+	}
+	var l *lut
+	var err error
+	var legacyLab bool
+	switch string(data[:4]) {
+	case "mft1":
+		l, err = readLUT8(data)
+	case "mft2":
+		l, err = readLUT16(data)
+		legacyLab = true
+	case "mAB ":
+		l, err = readLUTAtoB(data)
+	default:
+		return nil, fmt.Errorf("unsupported LUT type %q", data[:4])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.outputs != 3 {
+		return nil, fmt.Errorf("LUT has %d outputs, expected 3", l.outputs)
+	}
+	if l.inputs < 1 || l.inputs > maxLUTInputs {
+		return nil, fmt.Errorf("LUT has %d inputs", l.inputs)
+	}
+
+	// Undo the PCS encoding of the normalized outputs
+	switch {
+	case pcs == pcsXYZ:
+		l.decodePCS = func(v [3]float64) [3]float64 {
+			const scale = 65535.0 / 32768
+			return [3]float64{v[0] * scale, v[1] * scale, v[2] * scale}
+		}
+	case legacyLab:
+		// 16-bit legacy encoding: L 100 is 0xff00 and a, b 0 is 0x8000
+		l.decodePCS = func(v [3]float64) [3]float64 {
+			return labToXYZ(v[0]*65535/65280*100, v[1]*65535/256-128, v[2]*65535/256-128)
+		}
+	default:
+		l.decodePCS = func(v [3]float64) [3]float64 {
+			return labToXYZ(v[0]*100, v[1]*255-128, v[2]*255-128)
+		}
+	}
+	return l, nil
+}
+
+// readLUT8 decodes an lut8Type tag
+func readLUT8(data []byte) (*lut, error) {
+	if len(data) < 48 {
+		return nil, fmt.Errorf("lut8 is truncated")
+	}
+	in, out, grid := int(data[8]), int(data[9]), int(data[10])
+	l := &lut{inputs: in, outputs: out}
+
+	offset := 48
+	tables := func(n int) []curve {
+		curves := make([]curve, n)
+		for i := range curves {
+			table := make([]float64, 256)
+			for j := range table {
+				table[j] = float64(data[offset+j]) / 255
+			}
+			curves[i] = sampledCurve(table)
+			offset += 256
+		}
+		return curves
+	}
+
+	clutSize, ok := clutEntries(grid, in, out)
+	if !ok || 48+256*in+clutSize+256*out > len(data) {
+		return nil, fmt.Errorf("lut8 is truncated")
+	}
+	l.aCurves = tables(in)
+	l.clut = &clut{grid: uniformGrid(grid, in), outputs: out, data: make([]float64, clutSize)}
+	for i := range l.clut.data {
+		l.clut.data[i] = float64(data[offset+i]) / 255
+	}
+	offset += clutSize
+	l.bCurves = tables(out)
+	return l, nil
+}
+
+// readLUT16 decodes an lut16Type tag
+func readLUT16(data []byte) (*lut, error) {
+	if len(data) < 52 {
+		return nil, fmt.Errorf("lut16 is truncated")
+	}
+	in, out, grid := int(data[8]), int(data[9]), int(data[10])
+	inEntries := int(binary.BigEndian.Uint16(data[48:]))
+	outEntries := int(binary.BigEndian.Uint16(data[50:]))
+	l := &lut{inputs: in, outputs: out}
+
+	offset := 52
+	tables := func(n, entries int) []curve {
+		curves := make([]curve, n)
+		for i := range curves {
+			table := make([]float64, entries)
+			for j := range table {
+				table[j] = float64(binary.BigEndian.Uint16(data[offset+2*j:])) / 65535
+			}
+			curves[i] = sampledCurve(table)
+			offset += 2 * entries
+		}
+		return curves
+	}
+
+	clutSize, ok := clutEntries(grid, in, out)
+	if !ok || inEntries < 2 || outEntries < 2 ||
+		52+2*(in*inEntries+clutSize+out*outEntries) > len(data) {
+		return nil, fmt.Errorf("lut16 is truncated")
+	}
+	l.aCurves = tables(in, inEntries)
+	l.clut = &clut{grid: uniformGrid(grid, in), outputs: out, data: make([]float64, clutSize)}
+	for i := range l.clut.data {
+		l.clut.data[i] = float64(binary.BigEndian.Uint16(data[offset+2*i:])) / 65535
+	}
+	offset += 2 * clutSize
+	l.bCurves = tables(out, outEntries)
+	return l, nil
+}
+
+// readLUTAtoB decodes an lutAtoBType tag. Every element is optional except
+// the B curves.
+func readLUTAtoB(data []byte) (*lut, error) {
+	in, out := int(data[8]), int(data[9])
+	l := &lut{inputs: in, outputs: out}
+
+	// A zero offset marks an absent element; any other offset must be
+	// inside the tag
+	var truncated bool
+	element := func(at int) ([]byte, bool) {
+		offset := int(binary.BigEndian.Uint32(data[at:]))
+		if offset == 0 {
+			return nil, false
+		}
+		if offset >= len(data) {
+			truncated = true
+			return nil, false
+		}
+		return data[offset:], true
+	}
+	b, hasB := element(12)
+	m, hasMatrix := element(16)
+	mCurves, hasM := element(20)
+	c, hasCLUT := element(24)
+	a, hasA := element(28)
+	if truncated {
+		return nil, fmt.Errorf("lutAtoB is truncated")
+	}
+
+	var err error
+	if !hasB {
+		return nil, fmt.Errorf("lutAtoB has no B curves")
+	}
+	if l.bCurves, err = readCurves(b, out); err != nil {
+		return nil, err
+	}
+
+	if hasMatrix {
+		if len(m) < 48 {
+			return nil, fmt.Errorf("lutAtoB matrix is truncated")
+		}
+		l.matrix = new([12]float64)
+		for i := range l.matrix {
+			l.matrix[i] = s15Fixed16(m[4*i:])
+		}
+	}
+	if hasM {
+		if l.mCurves, err = readCurves(mCurves, out); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasCLUT {
+		if len(c) < 20 || in > maxLUTInputs {
+			return nil, fmt.Errorf("lutAtoB CLUT is truncated")
+		}
+		grid := make([]int, in)
+		size := out
+		for i := range grid {
+			grid[i] = int(c[i])
+			size = min(size*grid[i], maxCLUTEntries+1)
+		}
+		precision := int(c[16])
+		if (precision != 1 && precision != 2) || size == 0 || size > maxCLUTEntries || 20+precision*size > len(c) {
+			return nil, fmt.Errorf("lutAtoB CLUT is truncated")
+		}
+		l.clut = &clut{grid: grid, outputs: out, data: make([]float64, size)}
+		for i := range l.clut.data {
+			if precision == 1 {
+				l.clut.data[i] = float64(c[20+i]) / 255
+			} else {
+				l.clut.data[i] = float64(binary.BigEndian.Uint16(c[20+2*i:])) / 65535
+			}
+		}
+	} else if in != out {
+		return nil, fmt.Errorf("lutAtoB without a CLUT must not change the channel count")
+	}
+
+	if hasA {
+		if l.aCurves, err = readCurves(a, in); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// clutEntries is the number of values in a CLUT with the same number of
+// grid points in every dimension, reporting false when it is empty
+func clutEntries(grid, inputs, outputs int) (int, bool) {
+	if grid < 2 || inputs < 1 || inputs > maxLUTInputs {
+		return 0, false
+	}
+	size := outputs
+	for range inputs {
+		size *= grid
+		if size > maxCLUTEntries {
+			return 0, false
+		}
+	}
+	return size, size > 0
+}
+
+// uniformGrid repeats the grid point count for every dimension
+func uniformGrid(points, inputs int) []int {
+	grid := make([]int, inputs)
+	for i := range grid {
+		grid[i] = points
+	}
+	return grid
+}
+
+// toXYZ runs device values in [0, 1] through the LUT and decodes the PCS
+func (l *lut) toXYZ(in []float64) [3]float64 {
+	var v [maxLUTInputs]float64
+	for i := 0; i < l.inputs; i++ {
+		v[i] = clamp01(in[i])
+		if l.aCurves != nil {
+			v[i] = l.aCurves[i](v[i])
+		}
+	}
+
+	var out [3]float64
+	if l.clut != nil {
+		l.clut.eval(v[:l.inputs], out[:])
+	} else {
+		copy(out[:], v[:3])
+	}
+
+	if l.mCurves != nil {
+		for i := range out {
+			out[i] = l.mCurves[i](out[i])
+		}
+	}
+	if m := l.matrix; m != nil {
+		out = [3]float64{
+			m[0]*out[0] + m[1]*out[1] + m[2]*out[2] + m[9],
+			m[3]*out[0] + m[4]*out[1] + m[5]*out[2] + m[10],
+			m[6]*out[0] + m[7]*out[1] + m[8]*out[2] + m[11],
+		}
+	}
+	for i := range out {
+		out[i] = l.bCurves[i](clamp01(out[i]))
+	}
+
+	return l.decodePCS(out)
+}
+
+// eval interpolates the table multilinearly at the normalized input. The
+// first input varies slowest in the table.
+func (c *clut) eval(in []float64, out []float64) {
+	n := len(in)
+	var base [maxLUTInputs]int
+	var frac [maxLUTInputs]float64
+	var stride [maxLUTInputs]int
+
+	step := c.outputs
+	for i := n - 1; i >= 0; i-- {
+		stride[i] = step
+		step *= c.grid[i]
+
+		pos := in[i] * float64(c.grid[i]-1)
+		base[i] = min(int(pos), c.grid[i]-2)
+		if base[i] < 0 {
+			base[i] = 0
+		}
+		frac[i] = pos - float64(base[i])
+	}
+
+	for i := range out {
+		out[i] = 0
+	}
+	for corner := 0; corner < 1<<n; corner++ {
+		weight := 1.0
+		index := 0
+		for i := 0; i < n; i++ {
+			if corner&(1<<i) != 0 {
+				weight *= frac[i]
+				index += (base[i] + 1) * stride[i]
+			} else {
+				weight *= 1 - frac[i]
+				index += base[i] * stride[i]
+			}
+		}
+		if weight == 0 {
+			continue
+		}
+		for o := range out {
+			out[o] += weight * c.data[index+o]
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package icc
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// lut8 builds an lut8Type tag with identity curves and three outputs
+func lut8(inputs, grid int, clut []byte) []byte {
+	out := []byte("mft1\x00\x00\x00\x00")
+	out = append(out, byte(inputs), 3, byte(grid), 0)
+	// Identity matrix, only used with XYZ input
+	for i := 0; i < 9; i++ {
+		v := uint32(0)
+		if i%4 == 0 {
+			v = 1 << 16
+		}
+		out = binary.BigEndian.AppendUint32(out, v)
+	}
+	identityTable := make([]byte, 256)
+	for i := range identityTable {
+		identityTable[i] = byte(i)
+	}
+	for i := 0; i < inputs; i++ {
+		out = append(out, identityTable...)
+	}
+	out = append(out, clut...)
+	for i := 0; i < 3; i++ {
+		out = append(out, identityTable...)
+	}
+	return out
+}
+
+// lut16 builds a three input lut16Type tag with two-entry identity curves
+// and a 2x2x2 table
+func lut16() []byte {
+	out := []byte("mft2\x00\x00\x00\x00")
+	out = append(out, 3, 3, 2, 0)
+	out = append(out, make([]byte, 36)...)
+	out = binary.BigEndian.AppendUint16(out, 2)
+	out = binary.BigEndian.AppendUint16(out, 2)
+	for i := 0; i < 3; i++ {
+		out = binary.BigEndian.AppendUint16(out, 0)
+		out = binary.BigEndian.AppendUint16(out, 0xffff)
+	}
+	for i := 0; i < 8*3; i++ {
+		out = binary.BigEndian.AppendUint16(out, uint16(i*2000))
+	}
+	for i := 0; i < 3; i++ {
+		out = binary.BigEndian.AppendUint16(out, 0)
+		out = binary.BigEndian.AppendUint16(out, 0xffff)
+	}
+	return out
+}
+
+// lutAtoB builds a three input lutAtoBType tag with identity B and A curves
+// around a 2x2x2 8-bit table
+func lutAtoB() []byte {
+	identityCurve := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x00")
+	const bOffset, clutOffset, aOffset = 32, 32 + 36, 32 + 36 + 44
+
+	out := []byte("mAB \x00\x00\x00\x00")
+	out = append(out, 3, 3, 0, 0)
+	for _, offset := range []uint32{bOffset, 0, 0, clutOffset, aOffset} {
+		out = binary.BigEndian.AppendUint32(out, offset)
+	}
+	for i := 0; i < 3; i++ {
+		out = append(out, identityCurve...)
+	}
+	grid := make([]byte, 16)
+	grid[0], grid[1], grid[2] = 2, 2, 2
+	out = append(out, grid...)
+	out = append(out, 1, 0, 0, 0)
+	for i := 0; i < 8*3; i++ {
+		out = append(out, byte(i*10))
+	}
+	for i := 0; i < 3; i++ {
+		out = append(out, identityCurve...)
+	}
+	return out
+}
+
+func TestReadLUT(t *testing.T) {
+	clut := make([]byte, 8*3)
+	for i := range clut {
+		clut[i] = byte(i * 10)
+	}
+	for name, data := range map[string][]byte{
+		"lut8":    lut8(3, 2, clut),
+		"lut16":   lut16(),
+		"lutAtoB": lutAtoB(),
+	} {
+		l, err := readLUT(data, pcsXYZ)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if l.inputs != 3 || l.outputs != 3 {
+			t.Errorf("%s: read %d inputs and %d outputs, want 3 and 3", name, l.inputs, l.outputs)
+		}
+	}
+}
+
+func TestReadLUTRejectsTruncated(t *testing.T) {
+	clut := make([]byte, 16*3)
+	for name, data := range map[string][]byte{
+		"lut8":    lut8(4, 2, clut),
+		"lut16":   lut16(),
+		"lutAtoB": lutAtoB(),
+	} {
+		// Every cut short of the full tag must fail without panicking
+		for n := 0; n < len(data); n++ {
+			if _, err := readLUT(data[:n], pcsLab); err == nil {
+				t.Errorf("%s: accepted a tag truncated to %d of %d bytes", name, n, len(data))
+			}
+		}
+	}
+}
+
+func TestReadLUTRejectsInvalid(t *testing.T) {
+	tooManyOutputs := lut8(3, 2, make([]byte, 8*3))
+	tooManyOutputs[9] = 4
+
+	singlePoint := lut8(3, 2, make([]byte, 8*3))
+	singlePoint[10] = 1
+
+	hugeGrid := lutAtoB()
+	for i := 0; i < 3; i++ {
+		hugeGrid[32+36+i] = 255
+	}
+
+	noBCurves := lutAtoB()
+	binary.BigEndian.PutUint32(noBCurves[12:], 0)
+
+	for name, data := range map[string][]byte{
+		"unknown type":     append([]byte("mft3"), make([]byte, 60)...),
+		"four outputs":     tooManyOutputs,
+		"single grid step": singlePoint,
+		"huge grid":        hugeGrid,
+		"no B curves":      noBCurves,
+	} {
+		if _, err := readLUT(data, pcsLab); err == nil {
+			t.Errorf("%s: readLUT succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package icc
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// srgbCurvePoints is the number of samples in the sRGB tone curve
+const srgbCurvePoints = 1024
+
+// SRGB returns a version 2 sRGB IEC61966-2.1 profile, suitable for embedding
+// in outputs. The slice is shared and must not be modified.
+var SRGB = sync.OnceValue(func() []byte {
+	var trc []byte
+	trc = append(trc, "curv\x00\x00\x00\x00"...)
+	trc = binary.BigEndian.AppendUint32(trc, srgbCurvePoints)
+	for i := 0; i < srgbCurvePoints; i++ {
+		v := srgbToLinear(float64(i) / (srgbCurvePoints - 1))
+		trc = binary.BigEndian.AppendUint16(trc, uint16(math.Round(v*65535)))
+	}
+
+	name := "sRGB IEC61966-2.1"
+	var desc []byte
+	desc = append(desc, "desc\x00\x00\x00\x00"...)
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(name)+1))
+	desc = append(desc, name...)
+	desc = append(desc, 0)
+	// Empty Unicode and ScriptCode descriptions
+	desc = append(desc, make([]byte, 4+4+2+1+67)...)
+
+	cprt := append([]byte("text\x00\x00\x00\x00"), "No copyright, use freely\x00"...)
+
+	// The three tone curves share one copy of the data
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := []tag{
+		{"desc", desc},
+		{"cprt", cprt},
+		{"wtpt", xyzTag(d50)},
+		{"rXYZ", xyzTag([3]float64{srgbPrimaries[0][0], srgbPrimaries[1][0], srgbPrimaries[2][0]})},
+		{"gXYZ", xyzTag([3]float64{srgbPrimaries[0][1], srgbPrimaries[1][1], srgbPrimaries[2][1]})},
+		{"bXYZ", xyzTag([3]float64{srgbPrimaries[0][2], srgbPrimaries[1][2], srgbPrimaries[2][2]})},
+		{"rTRC", trc},
+		{"gTRC", nil},
+		{"bTRC", nil},
+	}
+
+	// Lay out the tag data after the tag table, four byte aligned
+	offsets := make([]int, len(tags))
+	sizes := make([]int, len(tags))
+	var body []byte
+	dataStart := headerSize + 4 + 12*len(tags)
+	for i, t := range tags {
+		if t.data == nil {
+			offsets[i], sizes[i] = offsets[i-1], sizes[i-1]
+			continue
+		}
+		offsets[i], sizes[i] = dataStart+len(body), len(t.data)
+		body = append(body, t.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	size := dataStart + len(body)
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(size))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], ColorSpaceRGB)
+	copy(header[20:], pcsXYZ)
+	copy(header[36:], "acsp")
+	copy(header[68:], xyzTag(d50)[8:])
+
+	out := make([]byte, 0, size)
+	out = append(out, header...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(tags)))
+	for i, t := range tags {
+		out = append(out, t.sig...)
+		out = binary.BigEndian.AppendUint32(out, uint32(offsets[i]))
+		out = binary.BigEndian.AppendUint32(out, uint32(sizes[i]))
+	}
+	return append(out, body...)
+})
+
+// xyzTag encodes an XYZType tag with a single value
+func xyzTag(xyz [3]float64) []byte {
+	out := []byte("XYZ \x00\x00\x00\x00")
+	for _, v := range xyz {
+		out = binary.BigEndian.AppendUint32(out, uint32(int32(math.Round(v*65536))))
+	}
+	return out
+}
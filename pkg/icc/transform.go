@@ -0,0 +1,156 @@
+package icc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// xyzToLinearSRGB converts PCS XYZ (D50) to linear sRGB, with the Bradford
+// adaptation from D50 to D65 folded in
+var xyzToLinearSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// srgbPrimaries are the sRGB colorants adapted to D50, as found in sRGB
+// profiles
+var srgbPrimaries = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// encodeSize is the number of entries in the linear to sRGB encoding table
+const encodeSize = 4096
+
+// srgbEncode maps linear light, quantized to encodeSize steps, to 8-bit sRGB
+var srgbEncode = func() [encodeSize]uint8 {
+	var table [encodeSize]uint8
+	for i := range table {
+		table[i] = uint8(math.Round(srgbFromLinear(float64(i)/(encodeSize-1)) * 255))
+	}
+	return table
+}()
+
+// srgbToLinear applies the sRGB decoding curve
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// srgbFromLinear applies the sRGB encoding curve
+func srgbFromLinear(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// IsSRGB reports whether the profile describes sRGB closely enough that its
+// pixels need no conversion
+func (p *Profile) IsSRGB() bool {
+	if p.ColorSpace != ColorSpaceRGB || p.lut != nil {
+		return false
+	}
+	for row := range p.matrix {
+		for col := range p.matrix[row] {
+			if math.Abs(p.matrix[row][col]-srgbPrimaries[row][col]) > 0.002 {
+				return false
+			}
+		}
+	}
+	for _, c := range p.trc {
+		for v := 0.05; v < 1; v += 0.1 {
+			if math.Abs(c(v)-srgbToLinear(v)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB converts an image whose pixels are in the profile's color space to
+// sRGB. CMYK profiles need an *image.CMYK; alpha is kept for the others.
+func (p *Profile) ToSRGB(img image.Image) (*image.NRGBA, error) {
+	bounds := img.Bounds()
+	cmyk, isCMYK := img.(*image.CMYK)
+	if isCMYK != (p.ColorSpace == ColorSpaceCMYK) {
+		return nil, fmt.Errorf("icc: %s profile does not match the %T image", p.ColorSpace, img)
+	}
+
+	// Device values are 8-bit, so the matrix/TRC input curves are tabulated
+	var trc [3][256]float64
+	if p.lut == nil {
+		for c := range trc {
+			curve := p.trc[min(c, len(p.trc)-1)]
+			for v := range trc[c] {
+				trc[c][v] = curve(float64(v) / 255)
+			}
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	var in [4]float64
+	var last [4]uint8
+	var lastOut [3]uint8
+	cached := false
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := dst.Pix[(y-bounds.Min.Y)*dst.Stride:]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var px [4]uint8
+			alpha := uint8(0xff)
+			if isCMYK {
+				c := cmyk.CMYKAt(x, y)
+				px = [4]uint8{c.C, c.M, c.Y, c.K}
+			} else {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				px = [4]uint8{c.R, c.G, c.B}
+				alpha = c.A
+			}
+
+			// Neighboring pixels often share a color, which is worth
+			// skipping for the slow LUT transforms
+			if !cached || px != last {
+				var xyz [3]float64
+				switch {
+				case p.lut != nil:
+					for i := range in {
+						in[i] = float64(px[i]) / 255
+					}
+					xyz = p.lut.toXYZ(in[:])
+				case len(p.trc) == 1:
+					v := trc[0][px[0]]
+					xyz = [3]float64{d50[0] * v, v, d50[2] * v}
+				default:
+					r, g, b := trc[0][px[0]], trc[1][px[1]], trc[2][px[2]]
+					for i := range xyz {
+						xyz[i] = p.matrix[i][0]*r + p.matrix[i][1]*g + p.matrix[i][2]*b
+					}
+				}
+				lastOut = encodeSRGB(xyz)
+				last, cached = px, true
+			}
+
+			i := (x - bounds.Min.X) * 4
+			row[i], row[i+1], row[i+2], row[i+3] = lastOut[0], lastOut[1], lastOut[2], alpha
+		}
+	}
+
+	return dst, nil
+}
+
+// encodeSRGB converts PCS XYZ to 8-bit sRGB, clipping out of gamut colors
+func encodeSRGB(xyz [3]float64) [3]uint8 {
+	var out [3]uint8
+	for i, m := range xyzToLinearSRGB {
+		linear := clamp01(m[0]*xyz[0] + m[1]*xyz[1] + m[2]*xyz[2])
+		out[i] = srgbEncode[int(linear*(encodeSize-1)+0.5)]
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// maxSegmentPayload is the most a JPEG marker segment can hold after its
+// two length bytes
+const maxSegmentPayload = 0xffff - 2
+
+// pngSignatureAndIHDR is the length of the PNG signature and the IHDR chunk
+// that must come first
+const pngSignatureAndIHDR = 8 + 12 + 13
+
+// EmbedJPEG inserts the blocks as APP1 (EXIF, XMP), APP2 (ICC) and APP13
+// (IPTC) segments right after the start of image marker. The ICC profile is
+// split over as many segments as it needs; other blocks too large for a
+// single segment are left out.
+func EmbedJPEG(data []byte, raw Raw) []byte {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return data
+	}
+
+	var segments []byte
+	addSegment := func(marker byte, parts ...[]byte) {
+		size := 0
+		for _, p := range parts {
+			size += len(p)
+		}
+		if size > maxSegmentPayload {
+			return
+		}
+		segments = append(segments, 0xff, marker)
+		segments = binary.BigEndian.AppendUint16(segments, uint16(size+2))
+		for _, p := range parts {
+			segments = append(segments, p...)
+		}
+	}
+
+	if len(raw.EXIF) > 0 {
+		addSegment(0xe1, exifHeader, raw.EXIF)
+	}
+	// The sequence number and count of ICC chunks are single bytes
+	const iccChunkSize = maxSegmentPayload - 14
+	if count := (len(raw.ICC) + iccChunkSize - 1) / iccChunkSize; count <= 255 {
+		for seq := 0; seq < count; seq++ {
+			chunk := raw.ICC[seq*iccChunkSize : min((seq+1)*iccChunkSize, len(raw.ICC))]
+			addSegment(0xe2, iccHeader, []byte{byte(seq + 1), byte(count)}, chunk)
+		}
+	}
+	if len(raw.XMP) > 0 {
+		addSegment(0xe1, xmpHeader, raw.XMP)
+	}
+	if len(raw.IPTC) > 0 {
+		addSegment(0xed, photoshopHeader, photoshopIPTC(raw.IPTC))
+	}
+	if len(segments) == 0 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data)+len(segments))
+	out = append(out, data[:2]...)
+	out = append(out, segments...)
+	return append(out, data[2:]...)
+}
+
+// photoshopIPTC wraps an IPTC block in a Photoshop image resource block
+// (ID 0x0404) with an empty name
+func photoshopIPTC(iptc []byte) []byte {
+	out := make([]byte, 0, 12+len(iptc)+1)
+	out = append(out, "8BIM"...)
+	out = binary.BigEndian.AppendUint16(out, 0x0404)
+	out = append(out, 0, 0)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(iptc)))
+	out = append(out, iptc...)
+	if len(iptc)&1 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// EmbedPNG inserts the ICC profile as an iCCP chunk, the EXIF block as an
+// eXIf chunk and the XMP packet as an iTXt chunk right after IHDR. PNG has no
+// standard place for IPTC, so it is left out.
+func EmbedPNG(data []byte, raw Raw) []byte {
+	if len(data) < pngSignatureAndIHDR || string(data[12:16]) != "IHDR" {
+		return data
+	}
+
+	var chunks []byte
+	if len(raw.ICC) > 0 {
+		// Named profile followed by the compression method, always zlib
+		var iccp bytes.Buffer
+		iccp.WriteString("ICC profile")
+		iccp.Write([]byte{0, 0})
+		zw := zlib.NewWriter(&iccp)
+		zw.Write(raw.ICC)
+		zw.Close()
+		chunks = appendPNGChunk(chunks, "iCCP", iccp.Bytes())
+	}
+	if len(raw.EXIF) > 0 {
+		chunks = appendPNGChunk(chunks, "eXIf", raw.EXIF)
+	}
+	if len(raw.XMP) > 0 {
+		// Uncompressed, with empty language tag and translated keyword
+		var itxt bytes.Buffer
+		itxt.WriteString(xmpKeyword)
+		itxt.Write([]byte{0, 0, 0, 0, 0})
+		itxt.Write(raw.XMP)
+		chunks = appendPNGChunk(chunks, "iTXt", itxt.Bytes())
+	}
+	if len(chunks) == 0 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data)+len(chunks))
+	out = append(out, data[:pngSignatureAndIHDR]...)
+	out = append(out, chunks...)
+	return append(out, data[pngSignatureAndIHDR:]...)
+}
+
+// appendPNGChunk appends a chunk with its length and CRC
+func appendPNGChunk(out []byte, chunkType string, payload []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(payload)))
+	start := len(out)
+	out = append(out, chunkType...)
+	out = append(out, payload...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
@@ -0,0 +1,140 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// testImage is a small opaque image to embed metadata in
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 12))
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 16), uint8(y * 20), 128, 255})
+		}
+	}
+	return img
+}
+
+// largeICC is a fake profile that needs several JPEG APP2 segments
+func largeICC() []byte {
+	icc := make([]byte, 150000)
+	for i := range icc {
+		icc[i] = byte(i * 7)
+	}
+	return icc
+}
+
+func TestEmbedJPEG(t *testing.T) {
+	for _, policy := range []string{types.MetadataKeep, types.MetadataStripGPS, types.MetadataCopyright} {
+		t.Run(policy, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+				t.Fatalf("jpeg.Encode: %v", err)
+			}
+			source := Raw{EXIF: sampleEXIF(binary.BigEndian), IPTC: sampleIPTC(), XMP: []byte(sampleXMP)}
+			raw := source.Filter(policy, true)
+			raw.ICC = largeICC()
+
+			data := EmbedJPEG(buf.Bytes(), raw)
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("jpeg.Decode: %v", err)
+			}
+			if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 12 {
+				t.Errorf("decoded size is %v, want 16x12", img.Bounds().Size())
+			}
+
+			assertSameBlocks(t, Read(data, "jpeg"), raw)
+			exif, _ := parseFiltered(t, Read(data, "jpeg").EXIF)
+			if exif.Orientation != 1 {
+				t.Errorf("orientation is %d, want 1", exif.Orientation)
+			}
+		})
+	}
+}
+
+func TestEmbedJPEGSkipsOversizedBlocks(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	raw := Raw{XMP: make([]byte, maxSegmentPayload), IPTC: sampleIPTC()}
+
+	data := EmbedJPEG(buf.Bytes(), raw)
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+	got := Read(data, "jpeg")
+	if got.XMP != nil {
+		t.Errorf("an XMP packet too large for a segment was written")
+	}
+	if !bytes.Equal(got.IPTC, raw.IPTC) {
+		t.Errorf("IPTC is %q, want %q", got.IPTC, raw.IPTC)
+	}
+}
+
+func TestEmbedJPEGNothingToEmbed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	if data := EmbedJPEG(buf.Bytes(), Raw{}); !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("empty metadata changed the file")
+	}
+	if data := EmbedJPEG([]byte("not a jpeg"), Raw{XMP: []byte(sampleXMP)}); string(data) != "not a jpeg" {
+		t.Errorf("non-JPEG data was changed")
+	}
+}
+
+func TestEmbedPNG(t *testing.T) {
+	for _, policy := range []string{types.MetadataKeep, types.MetadataStripGPS, types.MetadataCopyright} {
+		t.Run(policy, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, testImage()); err != nil {
+				t.Fatalf("png.Encode: %v", err)
+			}
+			source := Raw{EXIF: sampleEXIF(binary.LittleEndian), IPTC: sampleIPTC(), XMP: []byte(sampleXMP)}
+			raw := source.Filter(policy, true)
+			raw.ICC = largeICC()
+
+			data := EmbedPNG(buf.Bytes(), raw)
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("png.Decode: %v", err)
+			}
+			if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 12 {
+				t.Errorf("decoded size is %v, want 16x12", img.Bounds().Size())
+			}
+
+			// PNG has no place for IPTC
+			raw.IPTC = nil
+			assertSameBlocks(t, Read(data, "png"), raw)
+		})
+	}
+}
+
+// assertSameBlocks fails unless every block read back matches the embedded one
+func assertSameBlocks(t *testing.T, got, want Raw) {
+	t.Helper()
+	for _, b := range []struct {
+		name      string
+		got, want []byte
+	}{
+		{"EXIF", got.EXIF, want.EXIF},
+		{"IPTC", got.IPTC, want.IPTC},
+		{"XMP", got.XMP, want.XMP},
+		{"ICC", got.ICC, want.ICC},
+	} {
+		if !bytes.Equal(b.got, b.want) {
+			t.Errorf("%s block read back as %d bytes, want %d", b.name, len(b.got), len(b.want))
+		}
+	}
+}
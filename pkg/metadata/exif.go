@@ -0,0 +1,327 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// TIFF and EXIF tags
+const (
+	tagImageDescription = 0x010e
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagArtist           = 0x013b
+	tagXMP              = 0x02bc
+	tagCopyright        = 0x8298
+	tagIPTC             = 0x83bb
+	tagICC              = 0x8773
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+
+	tagExposureTime       = 0x829a
+	tagFNumber            = 0x829d
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTime         = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920a
+	tagLensMake           = 0xa433
+	tagLensModel          = 0xa434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+)
+
+// typeSizes is the size in bytes of one value of each TIFF field type
+var typeSizes = map[uint16]int{
+	typeByte: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8,
+	6: 1, typeUndefined: 1, 8: 2, typeSLong: 4, typeSRational: 8, 11: 4, 12: 8,
+}
+
+// exifTimeLayout is the EXIF date and time format
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// tiffEntry is one IFD entry with its value bytes
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// byteOrder reads and appends values in the byte order of a TIFF structure
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffReader reads IFDs from a TIFF structure
+type tiffReader struct {
+	data  []byte
+	order byteOrder
+}
+
+// newTIFFReader checks the TIFF header and returns a reader with the offset
+// of the first IFD
+func newTIFFReader(data []byte) (*tiffReader, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("metadata: TIFF header too short")
+	}
+	var order byteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, fmt.Errorf("metadata: invalid TIFF byte order")
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, 0, fmt.Errorf("metadata: invalid TIFF magic number")
+	}
+	return &tiffReader{data: data, order: order}, order.Uint32(data[4:]), nil
+}
+
+// readIFD reads the entries of the IFD at offset. Entries of unknown types
+// or pointing outside the data are skipped.
+func (r *tiffReader) readIFD(offset uint32) (map[uint16]tiffEntry, error) {
+	start := int64(offset)
+	if start+2 > int64(len(r.data)) {
+		return nil, fmt.Errorf("metadata: IFD offset %d is out of range", offset)
+	}
+	count := int(r.order.Uint16(r.data[start:]))
+
+	entries := make(map[uint16]tiffEntry, count)
+	for i := 0; i < count; i++ {
+		p := start + 2 + int64(i)*12
+		if p+12 > int64(len(r.data)) {
+			break
+		}
+		e := tiffEntry{
+			tag:   r.order.Uint16(r.data[p:]),
+			typ:   r.order.Uint16(r.data[p+2:]),
+			count: r.order.Uint32(r.data[p+4:]),
+		}
+		size := int64(typeSizes[e.typ]) * int64(e.count)
+		if size == 0 {
+			continue
+		}
+		if size <= 4 {
+			e.value = r.data[p+8 : p+8+size]
+		} else {
+			valueOffset := int64(r.order.Uint32(r.data[p+8:]))
+			if valueOffset+size > int64(len(r.data)) {
+				continue
+			}
+			e.value = r.data[valueOffset : valueOffset+size]
+		}
+		entries[e.tag] = e
+	}
+	return entries, nil
+}
+
+// subIFD reads the IFD that the pointer tag in ifd points to
+func (r *tiffReader) subIFD(ifd map[uint16]tiffEntry, tag uint16) map[uint16]tiffEntry {
+	offset, ok := r.uint(ifd, tag)
+	if !ok {
+		return nil
+	}
+	sub, err := r.readIFD(offset)
+	if err != nil {
+		return nil
+	}
+	return sub
+}
+
+// ascii returns the text value of a tag, trimmed at the first NUL
+func (r *tiffReader) ascii(ifd map[uint16]tiffEntry, tag uint16) string {
+	e, ok := ifd[tag]
+	if !ok || (e.typ != typeASCII && e.typ != typeUndefined && e.typ != typeByte) {
+		return ""
+	}
+	value, _, _ := bytes.Cut(e.value, []byte{0})
+	return strings.TrimSpace(string(value))
+}
+
+// uint returns the first value of an integer tag
+func (r *tiffReader) uint(ifd map[uint16]tiffEntry, tag uint16) (uint32, bool) {
+	e, ok := ifd[tag]
+	if !ok {
+		return 0, false
+	}
+	switch e.typ {
+	case typeByte, typeUndefined:
+		return uint32(e.value[0]), true
+	case typeShort:
+		return uint32(r.order.Uint16(e.value)), true
+	case typeLong, typeSLong:
+		return r.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+// rational returns the i-th value of a rational tag as numerator and
+// denominator
+func (r *tiffReader) rational(ifd map[uint16]tiffEntry, tag uint16, i int) (float64, float64, bool) {
+	e, ok := ifd[tag]
+	if !ok || (e.typ != typeRational && e.typ != typeSRational) || int64(i) >= int64(e.count) {
+		return 0, 0, false
+	}
+	num, den := r.order.Uint32(e.value[i*8:]), r.order.Uint32(e.value[i*8+4:])
+	if den == 0 {
+		return 0, 0, false
+	}
+	if e.typ == typeSRational {
+		return float64(int32(num)), float64(int32(den)), true
+	}
+	return float64(num), float64(den), true
+}
+
+// float returns the i-th value of a rational tag
+func (r *tiffReader) float(ifd map[uint16]tiffEntry, tag uint16, i int) (float64, bool) {
+	num, den, ok := r.rational(ifd, tag, i)
+	if !ok {
+		return 0, false
+	}
+	return num / den, true
+}
+
+// ParseEXIF decodes the camera, capture and GPS fields of an EXIF block.
+// The GPS result is nil when the block has no position.
+func ParseEXIF(data []byte) (*types.EXIFData, *types.GPSData, error) {
+	r, offset, err := newTIFFReader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	ifd0, err := r.readIFD(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	exifIFD := r.subIFD(ifd0, tagExifIFD)
+
+	exif := &types.EXIFData{
+		Make:        r.ascii(ifd0, tagMake),
+		Model:       r.ascii(ifd0, tagModel),
+		Software:    r.ascii(ifd0, tagSoftware),
+		Artist:      r.ascii(ifd0, tagArtist),
+		Copyright:   r.ascii(ifd0, tagCopyright),
+		Description: r.ascii(ifd0, tagImageDescription),
+		ModifyTime:  exifTime(r.ascii(ifd0, tagDateTime), r.ascii(exifIFD, tagOffsetTime)),
+		CaptureTime: exifTime(r.ascii(exifIFD, tagDateTimeOriginal), r.ascii(exifIFD, tagOffsetTimeOriginal)),
+		LensMake:    r.ascii(exifIFD, tagLensMake),
+		LensModel:   r.ascii(exifIFD, tagLensModel),
+	}
+	if v, ok := r.uint(ifd0, tagOrientation); ok {
+		exif.Orientation = int(v)
+	}
+	if v, ok := r.uint(exifIFD, tagISO); ok {
+		exif.ISO = int(v)
+	}
+	if v, ok := r.float(exifIFD, tagFNumber, 0); ok {
+		exif.FNumber = roundTo(v, 1)
+	}
+	if v, ok := r.float(exifIFD, tagFocalLength, 0); ok {
+		exif.FocalLength = roundTo(v, 1)
+	}
+	if num, den, ok := r.rational(exifIFD, tagExposureTime, 0); ok && num > 0 {
+		exif.ExposureTime = exposureTime(num, den)
+	}
+
+	return exif, parseGPS(r, r.subIFD(ifd0, tagGPSIFD)), nil
+}
+
+// parseGPS decodes the position in a GPS IFD, or returns nil if it has none
+func parseGPS(r *tiffReader, gpsIFD map[uint16]tiffEntry) *types.GPSData {
+	lat, okLat := gpsCoordinate(r, gpsIFD, tagGPSLatitude)
+	lon, okLon := gpsCoordinate(r, gpsIFD, tagGPSLongitude)
+	if !okLat || !okLon {
+		return nil
+	}
+	if r.ascii(gpsIFD, tagGPSLatitudeRef) == "S" {
+		lat = -lat
+	}
+	if r.ascii(gpsIFD, tagGPSLongitudeRef) == "W" {
+		lon = -lon
+	}
+
+	gps := &types.GPSData{Latitude: roundTo(lat, 6), Longitude: roundTo(lon, 6)}
+	if alt, ok := r.float(gpsIFD, tagGPSAltitude, 0); ok {
+		if ref, _ := r.uint(gpsIFD, tagGPSAltitudeRef); ref == 1 {
+			alt = -alt
+		}
+		alt = roundTo(alt, 1)
+		gps.Altitude = &alt
+	}
+	return gps
+}
+
+// gpsCoordinate converts degrees, minutes and seconds to decimal degrees
+func gpsCoordinate(r *tiffReader, gpsIFD map[uint16]tiffEntry, tag uint16) (float64, bool) {
+	var dms [3]float64
+	for i := range dms {
+		v, ok := r.float(gpsIFD, tag, i)
+		if !ok {
+			return 0, false
+		}
+		dms[i] = v
+	}
+	return dms[0] + dms[1]/60 + dms[2]/3600, true
+}
+
+// exifTime converts an EXIF date and time with an optional "+hh:mm" offset
+// to RFC 3339. Unparseable values are returned unchanged.
+func exifTime(value, offset string) string {
+	if value == "" {
+		return ""
+	}
+	if offset != "" {
+		if t, err := time.Parse(exifTimeLayout+"-07:00", value+offset); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	if t, err := time.Parse(exifTimeLayout, value); err == nil {
+		return t.Format("2006-01-02T15:04:05")
+	}
+	return value
+}
+
+// exposureTime formats an exposure as a fraction of a second, e.g. "1/250",
+// or in seconds when it is a second or longer
+func exposureTime(num, den float64) string {
+	if num >= den {
+		return strconv.FormatFloat(roundTo(num/den, 1), 'f', -1, 64)
+	}
+	return "1/" + strconv.FormatFloat(math.Round(den/num), 'f', -1, 64)
+}
+
+// roundTo rounds v to the given number of decimal places
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,219 @@
+package metadata
+
+import (
+	"bytes"
+	"slices"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// structuralTags describe how the source pixels were stored or point at
+// data that is not carried over, so they never describe a re-encoded output
+var structuralTags = map[uint16]bool{
+	0x0100: true, // ImageWidth
+	0x0101: true, // ImageLength
+	0x0102: true, // BitsPerSample
+	0x0103: true, // Compression
+	0x0106: true, // PhotometricInterpretation
+	0x0111: true, // StripOffsets
+	0x0115: true, // SamplesPerPixel
+	0x0116: true, // RowsPerStrip
+	0x0117: true, // StripByteCounts
+	0x011c: true, // PlanarConfiguration
+	0x0140: true, // ColorMap
+	0x0142: true, // TileWidth
+	0x0143: true, // TileLength
+	0x0144: true, // TileOffsets
+	0x0145: true, // TileByteCounts
+	0x014a: true, // SubIFDs
+	0x0152: true, // ExtraSamples
+	0x0153: true, // SampleFormat
+	0x0201: true, // JPEGInterchangeFormat
+	0x0202: true, // JPEGInterchangeFormatLength
+	0xa002: true, // PixelXDimension
+	0xa003: true, // PixelYDimension
+	0xa005: true, // Interoperability IFD
+	0x927c: true, // MakerNote, whose private offsets break when moved
+
+	// Written as separate blocks
+	tagXMP:  true,
+	tagIPTC: true,
+	tagICC:  true,
+}
+
+// copyrightTags are the EXIF tags the copyright policy keeps
+var copyrightTags = map[uint16]bool{
+	tagCopyright:   true,
+	tagOrientation: true,
+}
+
+// Filter returns the blocks an output may carry under a metadata policy.
+// EXIF is rebuilt without thumbnails or tags describing the source encoding;
+// resetOrientation sets its orientation to 1 for pixels already rotated
+// upright. Blocks that cannot be parsed are dropped, and the ICC profile is
+// never kept because the pixels are converted to sRGB on decode.
+func (r Raw) Filter(policy string, resetOrientation bool) Raw {
+	var out Raw
+	switch policy {
+	case types.MetadataKeep:
+		out.EXIF = rewriteEXIF(r.EXIF, nil, true, resetOrientation)
+		out.IPTC = r.IPTC
+		out.XMP = r.XMP
+	case types.MetadataStripGPS:
+		out.EXIF = rewriteEXIF(r.EXIF, nil, false, resetOrientation)
+		out.IPTC = r.IPTC
+		// XMP can repeat the position in exif:GPS* properties
+		if !bytes.Contains(r.XMP, []byte("GPSLatitude")) && !bytes.Contains(r.XMP, []byte("GPSLongitude")) {
+			out.XMP = r.XMP
+		}
+	case types.MetadataCopyright:
+		out.EXIF = rewriteEXIF(r.EXIF, copyrightTags, false, resetOrientation)
+		out.IPTC = filterIPTC(r.IPTC, iptcCopyright)
+	}
+	return out
+}
+
+// rewriteEXIF rebuilds an EXIF block in the original byte order with IFD0,
+// the Exif IFD and, if keepGPS is set, the GPS IFD. A non-nil keep limits
+// the result to those IFD0 tags. It returns nil when nothing is left.
+func rewriteEXIF(data []byte, keep map[uint16]bool, keepGPS, resetOrientation bool) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	r, offset, err := newTIFFReader(data)
+	if err != nil {
+		return nil
+	}
+	ifd0, err := r.readIFD(offset)
+	if err != nil {
+		return nil
+	}
+
+	var exifIFD, gpsIFD []tiffEntry
+	if keep == nil {
+		exifIFD = filterEntries(r.subIFD(ifd0, tagExifIFD), nil)
+		if keepGPS {
+			gpsIFD = filterEntries(r.subIFD(ifd0, tagGPSIFD), nil)
+		}
+	}
+
+	delete(ifd0, tagExifIFD)
+	delete(ifd0, tagGPSIFD)
+	if resetOrientation {
+		if _, ok := ifd0[tagOrientation]; ok {
+			ifd0[tagOrientation] = tiffEntry{
+				tag:   tagOrientation,
+				typ:   typeShort,
+				count: 1,
+				value: r.order.AppendUint16(nil, 1),
+			}
+		}
+	}
+	entries := filterEntries(ifd0, keep)
+
+	// The pointers are filled in once the layout is known
+	if len(exifIFD) > 0 {
+		entries = append(entries, tiffEntry{tag: tagExifIFD, typ: typeLong, count: 1})
+	}
+	if len(gpsIFD) > 0 {
+		entries = append(entries, tiffEntry{tag: tagGPSIFD, typ: typeLong, count: 1})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	slices.SortFunc(entries, func(a, b tiffEntry) int { return int(a.tag) - int(b.tag) })
+
+	// Layout: header, IFD0, Exif IFD, GPS IFD, each followed by its values
+	exifOffset := 8 + ifdSize(entries)
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	for i := range entries {
+		switch entries[i].tag {
+		case tagExifIFD:
+			entries[i].value = r.order.AppendUint32(nil, uint32(exifOffset))
+		case tagGPSIFD:
+			entries[i].value = r.order.AppendUint32(nil, uint32(gpsOffset))
+		}
+	}
+
+	out := make([]byte, 0, gpsOffset+ifdSize(gpsIFD))
+	out = append(out, data[:2]...)
+	out = r.order.AppendUint16(out, 42)
+	out = r.order.AppendUint32(out, 8)
+	out = appendIFD(out, r.order, entries)
+	if len(exifIFD) > 0 {
+		out = appendIFD(out, r.order, exifIFD)
+	}
+	if len(gpsIFD) > 0 {
+		out = appendIFD(out, r.order, gpsIFD)
+	}
+	return out
+}
+
+// filterEntries returns the entries of an IFD that are not structural and,
+// if keep is non-nil, are in keep, sorted by tag
+func filterEntries(ifd map[uint16]tiffEntry, keep map[uint16]bool) []tiffEntry {
+	var entries []tiffEntry
+	for tag, e := range ifd {
+		if structuralTags[tag] || (keep != nil && !keep[tag]) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b tiffEntry) int { return int(a.tag) - int(b.tag) })
+	return entries
+}
+
+// ifdSize is the number of bytes an IFD takes, including the values that do
+// not fit in its entries. An empty IFD is not written and takes none.
+func ifdSize(entries []tiffEntry) int {
+	if len(entries) == 0 {
+		return 0
+	}
+	size := 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			size += len(e.value) + len(e.value)&1
+		}
+	}
+	return size
+}
+
+// appendIFD appends an IFD with no next IFD, followed by the values that do
+// not fit in its entries, padded to even offsets
+func appendIFD(out []byte, order byteOrder, entries []tiffEntry) []byte {
+	dataOffset := len(out) + 2 + 12*len(entries) + 4
+	var values []byte
+
+	out = order.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		out = order.AppendUint16(out, e.tag)
+		out = order.AppendUint16(out, e.typ)
+		out = order.AppendUint32(out, e.count)
+		if len(e.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], e.value)
+			out = append(out, inline[:]...)
+			continue
+		}
+		out = order.AppendUint32(out, uint32(dataOffset+len(values)))
+		values = append(values, e.value...)
+		if len(e.value)&1 == 1 {
+			values = append(values, 0)
+		}
+	}
+	out = order.AppendUint32(out, 0)
+
+	return append(out, values...)
+}
+
+// filterIPTC keeps the record 2 datasets with the given numbers, returning
+// nil when none are present
+func filterIPTC(data []byte, datasets ...byte) []byte {
+	var out []byte
+	for _, d := range readIPTCDatasets(data) {
+		if d.record == 2 && slices.Contains(datasets, d.dataset) {
+			out = append(out, d.raw...)
+		}
+	}
+	return out
+}
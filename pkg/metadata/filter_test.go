@@ -0,0 +1,296 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// testEntry is an IFD entry for building test EXIF blocks
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// buildEXIF lays out a TIFF structure with IFD0 and optional Exif and GPS
+// IFDs. Values that do not fit in their entries are stored at the end.
+func buildEXIF(order byteOrder, ifd0, exif, gps []testEntry) []byte {
+	ifdLen := func(entries []testEntry) int {
+		if len(entries) == 0 {
+			return 0
+		}
+		return 2 + 12*len(entries) + 4
+	}
+	// The pointer entries take space in IFD0 before their offsets are known
+	if len(exif) > 0 {
+		ifd0 = append(ifd0, testEntry{tag: tagExifIFD, typ: typeLong, count: 1})
+	}
+	if len(gps) > 0 {
+		ifd0 = append(ifd0, testEntry{tag: tagGPSIFD, typ: typeLong, count: 1})
+	}
+	exifOffset := 8 + ifdLen(ifd0)
+	gpsOffset := exifOffset + ifdLen(exif)
+	valuesOffset := gpsOffset + ifdLen(gps)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			ifd0[i].value = order.AppendUint32(nil, uint32(exifOffset))
+		case tagGPSIFD:
+			ifd0[i].value = order.AppendUint32(nil, uint32(gpsOffset))
+		}
+	}
+
+	var values []byte
+	writeIFD := func(out []byte, entries []testEntry) []byte {
+		if len(entries) == 0 {
+			return out
+		}
+		out = order.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = order.AppendUint16(out, e.tag)
+			out = order.AppendUint16(out, e.typ)
+			out = order.AppendUint32(out, e.count)
+			if len(e.value) <= 4 {
+				out = append(out, append(e.value, make([]byte, 4-len(e.value))...)...)
+				continue
+			}
+			out = order.AppendUint32(out, uint32(valuesOffset+len(values)))
+			values = append(values, e.value...)
+		}
+		return order.AppendUint32(out, 0)
+	}
+
+	out := []byte("II")
+	if order == binary.BigEndian {
+		out = []byte("MM")
+	}
+	out = order.AppendUint16(out, 42)
+	out = order.AppendUint32(out, 8)
+	out = writeIFD(out, ifd0)
+	out = writeIFD(out, exif)
+	out = writeIFD(out, gps)
+	return append(out, values...)
+}
+
+func asciiEntry(tag uint16, s string) testEntry {
+	return testEntry{tag: tag, typ: typeASCII, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func shortEntry(order byteOrder, tag, v uint16) testEntry {
+	return testEntry{tag: tag, typ: typeShort, count: 1, value: order.AppendUint16(nil, v)}
+}
+
+func longEntry(order byteOrder, tag uint16, v uint32) testEntry {
+	return testEntry{tag: tag, typ: typeLong, count: 1, value: order.AppendUint32(nil, v)}
+}
+
+func rationalEntry(order byteOrder, tag uint16, pairs ...uint32) testEntry {
+	var value []byte
+	for _, v := range pairs {
+		value = order.AppendUint32(value, v)
+	}
+	return testEntry{tag: tag, typ: typeRational, count: uint32(len(pairs) / 2), value: value}
+}
+
+// sampleEXIF is a camera EXIF block with an orientation, a GPS position and
+// tags that describe the source encoding
+func sampleEXIF(order byteOrder) []byte {
+	ifd0 := []testEntry{
+		longEntry(order, 0x0100, 4000), // ImageWidth
+		longEntry(order, 0x0101, 3000), // ImageLength
+		asciiEntry(tagMake, "Canon"),
+		asciiEntry(tagModel, "EOS R5"),
+		longEntry(order, 0x0111, 1234), // StripOffsets
+		shortEntry(order, tagOrientation, 6),
+		asciiEntry(tagArtist, "Jane Doe"),
+		testEntry{tag: tagXMP, typ: typeUndefined, count: 5, value: []byte("<xmp>")},
+		asciiEntry(tagCopyright, "(c) Jane Doe"),
+	}
+	exif := []testEntry{
+		rationalEntry(order, tagExposureTime, 1, 250),
+		shortEntry(order, tagISO, 400),
+		asciiEntry(tagDateTimeOriginal, "2024:05:01 10:20:30"),
+		// MakerNote and PixelXDimension
+		testEntry{tag: 0x927c, typ: typeUndefined, count: 8, value: []byte("MAKERNOT")},
+		longEntry(order, 0xa002, 4000),
+	}
+	gps := []testEntry{
+		asciiEntry(tagGPSLatitudeRef, "N"),
+		rationalEntry(order, tagGPSLatitude, 52, 1, 30, 1, 0, 1),
+		asciiEntry(tagGPSLongitudeRef, "W"),
+		rationalEntry(order, tagGPSLongitude, 1, 1, 15, 1, 0, 1),
+	}
+	return buildEXIF(order, ifd0, exif, gps)
+}
+
+// iptcDatasetBytes encodes a record 2 IIM dataset
+func iptcDatasetBytes(dataset byte, value string) []byte {
+	out := []byte{iptcTagMarker, 2, dataset}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(value)))
+	return append(out, value...)
+}
+
+// sampleIPTC holds a headline, a creator and a copyright notice
+func sampleIPTC() []byte {
+	var out []byte
+	out = append(out, iptcDatasetBytes(iptcHeadline, "Harbor at dawn")...)
+	out = append(out, iptcDatasetBytes(iptcByline, "Jane Doe")...)
+	out = append(out, iptcDatasetBytes(iptcCopyright, "(c) Jane Doe")...)
+	return out
+}
+
+const sampleXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="52,30.0N" exif:GPSLongitude="1,15.0W"/>` +
+	`</rdf:RDF></x:xmpmeta>`
+
+func TestFilterPolicies(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		raw := Raw{
+			EXIF: sampleEXIF(order),
+			IPTC: sampleIPTC(),
+			XMP:  []byte(sampleXMP),
+			ICC:  []byte("profile"),
+		}
+
+		t.Run(order.String()+"/strip", func(t *testing.T) {
+			out := raw.Filter(types.MetadataStrip, false)
+			if out.EXIF != nil || out.IPTC != nil || out.XMP != nil || out.ICC != nil {
+				t.Errorf("strip kept %+v", out)
+			}
+			if out := raw.Filter("", false); out.EXIF != nil || out.IPTC != nil || out.XMP != nil {
+				t.Errorf("the default policy kept %+v", out)
+			}
+		})
+
+		t.Run(order.String()+"/keep", func(t *testing.T) {
+			out := raw.Filter(types.MetadataKeep, false)
+			exif, gps := parseFiltered(t, out.EXIF)
+			if exif.Make != "Canon" || exif.Model != "EOS R5" || exif.Artist != "Jane Doe" || exif.Copyright != "(c) Jane Doe" {
+				t.Errorf("IFD0 fields are %+v", exif)
+			}
+			if exif.ISO != 400 || exif.ExposureTime != "1/250" || exif.CaptureTime != "2024-05-01T10:20:30" {
+				t.Errorf("Exif IFD fields are %+v", exif)
+			}
+			if exif.Orientation != 6 {
+				t.Errorf("orientation is %d, want 6", exif.Orientation)
+			}
+			if gps == nil || gps.Latitude != 52.5 || gps.Longitude != -1.25 {
+				t.Errorf("GPS is %+v, want 52.5, -1.25", gps)
+			}
+			if !bytes.Equal(out.IPTC, raw.IPTC) || !bytes.Equal(out.XMP, raw.XMP) {
+				t.Errorf("IPTC or XMP were changed")
+			}
+			if out.ICC != nil {
+				t.Errorf("ICC profile was kept")
+			}
+			assertNoStructuralTags(t, out.EXIF)
+		})
+
+		t.Run(order.String()+"/keep reset orientation", func(t *testing.T) {
+			out := raw.Filter(types.MetadataKeep, true)
+			exif, _ := parseFiltered(t, out.EXIF)
+			if exif.Orientation != 1 {
+				t.Errorf("orientation is %d, want 1", exif.Orientation)
+			}
+			if exif.Make != "Canon" {
+				t.Errorf("make is %q after resetting the orientation", exif.Make)
+			}
+		})
+
+		t.Run(order.String()+"/strip_gps", func(t *testing.T) {
+			out := raw.Filter(types.MetadataStripGPS, true)
+			exif, gps := parseFiltered(t, out.EXIF)
+			if gps != nil {
+				t.Errorf("GPS is %+v, want none", gps)
+			}
+			if exif.Make != "Canon" || exif.ISO != 400 || exif.Orientation != 1 {
+				t.Errorf("fields are %+v", exif)
+			}
+			r, offset, _ := newTIFFReader(out.EXIF)
+			ifd0, _ := r.readIFD(offset)
+			if _, ok := ifd0[tagGPSIFD]; ok {
+				t.Errorf("GPS IFD pointer was kept")
+			}
+			if out.XMP != nil {
+				t.Errorf("XMP with a GPS position was kept")
+			}
+			if !bytes.Equal(out.IPTC, raw.IPTC) {
+				t.Errorf("IPTC was changed")
+			}
+			assertNoStructuralTags(t, out.EXIF)
+		})
+
+		t.Run(order.String()+"/copyright", func(t *testing.T) {
+			out := raw.Filter(types.MetadataCopyright, true)
+			exif, gps := parseFiltered(t, out.EXIF)
+			want := types.EXIFData{Copyright: "(c) Jane Doe", Orientation: 1}
+			if *exif != want {
+				t.Errorf("EXIF is %+v, want %+v", exif, want)
+			}
+			if gps != nil {
+				t.Errorf("GPS is %+v, want none", gps)
+			}
+			iptc := ParseIPTC(out.IPTC)
+			if iptc == nil || iptc.Copyright != "(c) Jane Doe" || iptc.Headline != "" || iptc.Creators != nil {
+				t.Errorf("IPTC is %+v, want only the copyright", iptc)
+			}
+			if out.XMP != nil {
+				t.Errorf("XMP was kept")
+			}
+		})
+	}
+}
+
+func TestFilterUnparseableEXIF(t *testing.T) {
+	raw := Raw{EXIF: []byte("not a TIFF structure")}
+	if out := raw.Filter(types.MetadataKeep, false); out.EXIF != nil {
+		t.Errorf("kept an unparseable EXIF block")
+	}
+}
+
+func TestFilterCopyrightWithoutCopyright(t *testing.T) {
+	order := binary.LittleEndian
+	raw := Raw{
+		EXIF: buildEXIF(order, []testEntry{asciiEntry(tagMake, "Canon")}, nil, nil),
+		IPTC: iptcDatasetBytes(iptcHeadline, "Harbor at dawn"),
+	}
+	out := raw.Filter(types.MetadataCopyright, false)
+	if out.EXIF != nil || out.IPTC != nil {
+		t.Errorf("copyright policy kept %+v", out)
+	}
+}
+
+// parseFiltered parses a rewritten EXIF block, failing if it cannot be read
+func parseFiltered(t *testing.T, data []byte) (*types.EXIFData, *types.GPSData) {
+	t.Helper()
+	exif, gps, err := ParseEXIF(data)
+	if err != nil {
+		t.Fatalf("ParseEXIF: %v", err)
+	}
+	return exif, gps
+}
+
+// assertNoStructuralTags fails if any IFD of the block has a tag describing
+// the source encoding
+func assertNoStructuralTags(t *testing.T, data []byte) {
+	t.Helper()
+	r, offset, err := newTIFFReader(data)
+	if err != nil {
+		t.Fatalf("newTIFFReader: %v", err)
+	}
+	ifd0, err := r.readIFD(offset)
+	if err != nil {
+		t.Fatalf("readIFD: %v", err)
+	}
+	for _, ifd := range []map[uint16]tiffEntry{ifd0, r.subIFD(ifd0, tagExifIFD), r.subIFD(ifd0, tagGPSIFD)} {
+		for tag := range ifd {
+			if structuralTags[tag] {
+				t.Errorf("structural tag %#04x was kept", tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf8"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// IPTC IIM application record (record 2) datasets
+const (
+	iptcObjectName  = 5
+	iptcKeywords    = 25
+	iptcDateCreated = 55
+	iptcByline      = 80
+	iptcCity        = 90
+	iptcCountry     = 101
+	iptcHeadline    = 105
+	iptcCredit      = 110
+	iptcSource      = 115
+	iptcCopyright   = 116
+	iptcCaption     = 120
+)
+
+// iptcTagMarker starts every IIM dataset
+const iptcTagMarker = 0x1c
+
+// iptcDataset is one IIM dataset, with its encoded bytes including the header
+type iptcDataset struct {
+	record  byte
+	dataset byte
+	value   []byte
+	raw     []byte
+}
+
+// readIPTCDatasets splits an IPTC IIM block into its datasets, stopping at
+// the first malformed one
+func readIPTCDatasets(data []byte) []iptcDataset {
+	var datasets []iptcDataset
+	for i := 0; i+5 <= len(data) && data[i] == iptcTagMarker; {
+		start := i
+		record, dataset := data[i+1], data[i+2]
+		size := int(binary.BigEndian.Uint16(data[i+3:]))
+		i += 5
+
+		// Extended datasets store the length of their length
+		if size&0x8000 != 0 {
+			n := size & 0x7fff
+			if n > 4 || i+n > len(data) {
+				break
+			}
+			size = 0
+			for _, b := range data[i : i+n] {
+				size = size<<8 | int(b)
+			}
+			i += n
+		}
+		if size < 0 || i+size > len(data) {
+			break
+		}
+		datasets = append(datasets, iptcDataset{
+			record:  record,
+			dataset: dataset,
+			value:   data[i : i+size],
+			raw:     data[start : i+size],
+		})
+		i += size
+	}
+	return datasets
+}
+
+// ParseIPTC decodes the editorial fields of an IPTC IIM block. It returns
+// nil when the block holds none of them.
+func ParseIPTC(data []byte) *types.IPTCData {
+	var iptc types.IPTCData
+	found := false
+
+	for _, d := range readIPTCDatasets(data) {
+		value := iptcString(d.value)
+		if d.record != 2 || value == "" {
+			continue
+		}
+		switch d.dataset {
+		case iptcObjectName:
+			iptc.Title = value
+		case iptcKeywords:
+			iptc.Keywords = append(iptc.Keywords, value)
+		case iptcDateCreated:
+			if len(value) == 8 {
+				value = value[:4] + "-" + value[4:6] + "-" + value[6:]
+			}
+			iptc.DateCreated = value
+		case iptcByline:
+			iptc.Creators = append(iptc.Creators, value)
+		case iptcCity:
+			iptc.City = value
+		case iptcCountry:
+			iptc.Country = value
+		case iptcHeadline:
+			iptc.Headline = value
+		case iptcCredit:
+			iptc.Credit = value
+		case iptcSource:
+			iptc.Source = value
+		case iptcCopyright:
+			iptc.Copyright = value
+		case iptcCaption:
+			iptc.Caption = value
+		default:
+			continue
+		}
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return &iptc
+}
+
+// iptcString decodes a dataset value. Modern files use UTF-8; anything else
+// is treated as Latin-1, the most common legacy encoding.
+func iptcString(b []byte) string {
+	if utf8.Valid(b) {
+		return strings.TrimSpace(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
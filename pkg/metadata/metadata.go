@@ -0,0 +1,272 @@
+// Package metadata finds and parses the EXIF, IPTC and XMP blocks and the ICC
+// profile embedded in JPEG, PNG, WebP and TIFF files.
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+)
+
+var (
+	exifHeader      = []byte("Exif\x00\x00")
+	xmpHeader       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	photoshopHeader = []byte("Photoshop 3.0\x00")
+	iccHeader       = []byte("ICC_PROFILE\x00")
+)
+
+// xmpKeyword is the PNG iTXt keyword of an XMP packet
+const xmpKeyword = "XML:com.adobe.xmp"
+
+// Raw holds the metadata blocks found in a file, still encoded
+type Raw struct {
+	EXIF []byte // TIFF structure, starting with the byte order mark
+	IPTC []byte // IPTC IIM datasets
+	XMP  []byte // XMP packet
+	ICC  []byte // ICC color profile
+}
+
+// Read finds the metadata blocks in a file of the given format (jpeg, png,
+// webp or tiff). Other formats carry no metadata and yield an empty Raw.
+// Malformed files yield whatever was found before the damage.
+func Read(data []byte, format string) Raw {
+	switch format {
+	case "jpeg":
+		return readJPEG(data)
+	case "png":
+		return readPNG(data)
+	case "webp":
+		return readWebP(data)
+	case "tiff":
+		return readTIFF(data)
+	}
+	return Raw{}
+}
+
+// readJPEG walks the marker segments up to the start of scan
+func readJPEG(data []byte) Raw {
+	var raw Raw
+	var iccChunks [][]byte
+
+segments:
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			break
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte before a marker
+			i++
+			continue
+		case marker == 0x01 || marker == 0xd8 || (marker >= 0xd0 && marker <= 0xd7):
+			// Markers without a payload
+			i += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			break segments
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		payload := data[i+4 : i+2+length]
+
+		switch {
+		case marker == 0xe1 && raw.EXIF == nil && bytes.HasPrefix(payload, exifHeader):
+			raw.EXIF = payload[len(exifHeader):]
+		case marker == 0xe1 && raw.XMP == nil && bytes.HasPrefix(payload, xmpHeader):
+			raw.XMP = payload[len(xmpHeader):]
+		case marker == 0xed && raw.IPTC == nil && bytes.HasPrefix(payload, photoshopHeader):
+			raw.IPTC = iptcFromPhotoshop(payload[len(photoshopHeader):])
+		case marker == 0xe2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2:
+			// Large profiles are split over several segments, numbered from 1
+			seq, count := int(payload[len(iccHeader)]), int(payload[len(iccHeader)+1])
+			if iccChunks == nil {
+				iccChunks = make([][]byte, count)
+			}
+			if seq >= 1 && seq <= len(iccChunks) {
+				iccChunks[seq-1] = payload[len(iccHeader)+2:]
+			}
+		}
+
+		i += 2 + length
+	}
+	raw.ICC = joinICCChunks(iccChunks)
+	return raw
+}
+
+// joinICCChunks reassembles an ICC profile split over APP2 segments. It
+// returns nil if any chunk is missing.
+func joinICCChunks(chunks [][]byte) []byte {
+	var profile []byte
+	for _, chunk := range chunks {
+		if chunk == nil {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// iptcFromPhotoshop returns the IPTC resource (ID 0x0404) from a list of
+// Photoshop image resource blocks
+func iptcFromPhotoshop(data []byte) []byte {
+	for i := 0; i+7 <= len(data); {
+		if string(data[i:i+4]) != "8BIM" {
+			return nil
+		}
+		id := binary.BigEndian.Uint16(data[i+4:])
+		i += 6
+
+		// Pascal string name, padded to an even length
+		nameLen := 1 + int(data[i])
+		i += nameLen + nameLen&1
+		if i+4 > len(data) {
+			return nil
+		}
+
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		i += 4
+		if size < 0 || i+size > len(data) {
+			return nil
+		}
+		if id == 0x0404 {
+			return data[i : i+size]
+		}
+		i += size + size&1
+	}
+	return nil
+}
+
+// readPNG walks the chunks for eXIf, iCCP and the XMP iTXt chunk
+func readPNG(data []byte) Raw {
+	var raw Raw
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		if length < 0 || i+12+length > len(data) {
+			break
+		}
+		payload := data[i+8 : i+8+length]
+
+		switch chunkType {
+		case "eXIf":
+			raw.EXIF = payload
+		case "iCCP":
+			raw.ICC = readICCP(payload)
+		case "iTXt":
+			if keyword, text, ok := readITXt(payload); ok && keyword == xmpKeyword {
+				raw.XMP = text
+			}
+		case "IEND":
+			return raw
+		}
+
+		i += 12 + length
+	}
+	return raw
+}
+
+// readITXt splits an iTXt chunk into its keyword and text, inflating the
+// text if it is compressed
+func readITXt(payload []byte) (string, []byte, bool) {
+	keyword, rest, ok := bytes.Cut(payload, []byte{0})
+	if !ok || len(rest) < 2 {
+		return "", nil, false
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+
+	// Skip the language tag and translated keyword
+	for range 2 {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return "", nil, false
+		}
+	}
+
+	if !compressed {
+		return string(keyword), rest, true
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return "", nil, false
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, false
+	}
+	return string(keyword), text, true
+}
+
+// readICCP inflates the profile of an iCCP chunk, which follows the profile
+// name and the compression method
+func readICCP(payload []byte) []byte {
+	_, rest, ok := bytes.Cut(payload, []byte{0})
+	if !ok || len(rest) < 1 || rest[0] != 0 {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest[1:]))
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	profile, err := io.ReadAll(zr)
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+// readWebP walks the RIFF chunks for EXIF, XMP and ICCP
+func readWebP(data []byte) Raw {
+	var raw Raw
+	for i := 12; i+8 <= len(data); {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > len(data) {
+			break
+		}
+		payload := data[i+8 : i+8+size]
+
+		switch fourCC {
+		case "EXIF":
+			// Some writers keep the JPEG APP1 header
+			raw.EXIF = bytes.TrimPrefix(payload, exifHeader)
+		case "XMP ":
+			raw.XMP = payload
+		case "ICCP":
+			raw.ICC = payload
+		}
+
+		i += 8 + size + size&1
+	}
+	return raw
+}
+
+// readTIFF treats the whole file as the EXIF block and picks the IPTC and
+// XMP blocks and the ICC profile out of the first IFD
+func readTIFF(data []byte) Raw {
+	raw := Raw{EXIF: data}
+	r, offset, err := newTIFFReader(data)
+	if err != nil {
+		return Raw{}
+	}
+	ifd, err := r.readIFD(offset)
+	if err != nil {
+		return raw
+	}
+	if e, ok := ifd[tagIPTC]; ok {
+		raw.IPTC = e.value
+	}
+	if e, ok := ifd[tagXMP]; ok {
+		raw.XMP = e.value
+	}
+	if e, ok := ifd[tagICC]; ok {
+		raw.ICC = e.value
+	}
+	return raw
+}
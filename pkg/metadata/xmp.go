@@ -0,0 +1,150 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// rdfNS is the RDF namespace XMP properties are serialized in
+const rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// xmpPrefixes maps well-known XMP namespaces to their customary prefixes.
+// Properties in other namespaces are keyed by namespace URI and name.
+var xmpPrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":             "dc",
+	"http://ns.adobe.com/xap/1.0/":                 "xmp",
+	"http://ns.adobe.com/xap/1.0/rights/":          "xmpRights",
+	"http://ns.adobe.com/xap/1.0/mm/":              "xmpMM",
+	"http://ns.adobe.com/photoshop/1.0/":           "photoshop",
+	"http://ns.adobe.com/tiff/1.0/":                "tiff",
+	"http://ns.adobe.com/exif/1.0/":                "exif",
+	"http://ns.adobe.com/exif/1.0/aux/":            "aux",
+	"http://cipa.jp/exif/1.0/":                     "exifEX",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/":  "Iptc4xmpCore",
+	"http://iptc.org/std/Iptc4xmpExt/2008-02-29/":  "Iptc4xmpExt",
+	"http://ns.adobe.com/lightroom/1.0/":           "lr",
+	"http://ns.adobe.com/camera-raw-settings/1.0/": "crs",
+	"http://ns.google.com/photos/1.0/panorama/":    "GPano",
+}
+
+// ParseXMP flattens the properties of an XMP packet into a map keyed by
+// prefix:name. Simple values and language alternatives become strings;
+// bags and sequences become string slices. Nested structures are skipped.
+func ParseXMP(data []byte) (map[string]any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	props := make(map[string]any)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return props, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != rdfNS || start.Name.Local != "Description" {
+			continue
+		}
+
+		// Simple properties are often written as attributes
+		for _, attr := range start.Attr {
+			if attr.Name.Space == "" || attr.Name.Space == "xmlns" || attr.Name.Space == rdfNS {
+				continue
+			}
+			props[xmpName(attr.Name)] = attr.Value
+		}
+
+		if err := readDescription(dec, props); err != nil {
+			return props, err
+		}
+	}
+
+	return props, nil
+}
+
+// readDescription reads the property elements of an rdf:Description up to
+// its end tag
+func readDescription(dec *xml.Decoder, props map[string]any) error {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			value, err := readProperty(dec, t)
+			if err != nil {
+				return err
+			}
+			if value != nil {
+				props[xmpName(t.Name)] = value
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// readProperty reads one property element up to its end tag
+func readProperty(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == rdfNS && attr.Name.Local == "resource" {
+			return attr.Value, dec.Skip()
+		}
+	}
+
+	var text strings.Builder
+	var items []string
+	isAlt := false
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == rdfNS && t.Name.Local == "li" {
+				var item string
+				if err := dec.DecodeElement(&item, &t); err != nil {
+					return nil, err
+				}
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+				continue
+			}
+			if t.Name.Space == rdfNS && t.Name.Local == "Alt" {
+				isAlt = true
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 1 {
+				text.Write(t)
+			}
+		}
+	}
+
+	switch {
+	case len(items) > 0 && isAlt:
+		// Language alternatives list the default language first
+		return items[0], nil
+	case len(items) > 0:
+		return items, nil
+	case strings.TrimSpace(text.String()) != "":
+		return strings.TrimSpace(text.String()), nil
+	}
+	return nil, nil
+}
+
+// xmpName returns the prefix:name key of a property
+func xmpName(name xml.Name) string {
+	if prefix, ok := xmpPrefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return name.Space + name.Local
+}
@@ -0,0 +1,56 @@
+// Package phash computes perceptual hashes, which stay nearly the same when
+// an image is resized, recompressed or slightly edited, for finding
+// near-duplicate images.
+package phash
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultMaxDistance is the Hamming distance below which two dHashes are
+// usually the same photo
+const DefaultMaxDistance = 10
+
+// DHash computes a 64-bit difference hash. The image is reduced to 9x8
+// grayscale pixels and each bit records whether a pixel is brighter than
+// its right-hand neighbor.
+func DHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		row := small.Pix[y*small.Stride:]
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if row[x*4] > row[(x+1)*4] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns the Hamming distance between two hashes, the number of
+// bits that differ. Identical images score 0; unrelated images average 32.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format encodes a hash as 16 hex digits
+func Format(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// Parse decodes a hash formatted with Format
+func Parse(s string) (uint64, error) {
+	hash, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q", s)
+	}
+	return hash, nil
+}
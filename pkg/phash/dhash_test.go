@@ -0,0 +1,120 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// scene is a photo-like image: broad brightness changes along both axes
+// with fine texture on top
+func scene(w, h int, freq float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			u, v := float64(x)/float64(w), float64(y)/float64(h)
+			l := 128 + 60*math.Sin(freq*u*math.Pi+1)*math.Cos(freq*0.7*v*math.Pi) + 30*u +
+				25*math.Sin(float64(x)*0.31)*math.Sin(float64(y)*0.23)
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(l), G: uint8(l * 0.8), B: uint8(255 - l), A: 255})
+		}
+	}
+	return img
+}
+
+// recompress encodes the image as JPEG and decodes it again
+func recompress(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+	return out
+}
+
+func TestDHashStable(t *testing.T) {
+	src := scene(640, 480, 3)
+	hash := DHash(src)
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"same image", src},
+		{"half size", imaging.Resize(src, 320, 240, imaging.Lanczos)},
+		{"thumbnail", imaging.Resize(src, 64, 48, imaging.Lanczos)},
+		{"upscaled", imaging.Resize(src, 1280, 960, imaging.Linear)},
+		{"stretched", imaging.Resize(src, 640, 360, imaging.Lanczos)},
+		{"recompressed", recompress(t, src, 50)},
+		{"resized and recompressed", recompress(t, imaging.Resize(src, 200, 150, imaging.Lanczos), 30)},
+		{"brightened", imaging.AdjustBrightness(src, 10)},
+	}
+	for _, tt := range tests {
+		if d := Distance(hash, DHash(tt.img)); d > DefaultMaxDistance/2 {
+			t.Errorf("%s: distance is %d, want at most %d", tt.name, d, DefaultMaxDistance/2)
+		}
+	}
+}
+
+func TestDHashDistinguishes(t *testing.T) {
+	src := scene(640, 480, 3)
+	hash := DHash(src)
+
+	for name, img := range map[string]image.Image{
+		"mirrored":        imaging.FlipH(src),
+		"other scene":     scene(640, 480, 7),
+		"rotated quarter": imaging.Resize(imaging.Rotate90(src), 640, 480, imaging.Lanczos),
+	} {
+		if d := Distance(hash, DHash(img)); d <= DefaultMaxDistance {
+			t.Errorf("%s: distance is %d, want more than %d", name, d, DefaultMaxDistance)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0xffffffffffffffff, 0xffffffffffffffff, 0},
+		{0, 0xffffffffffffffff, 64},
+		{0b1011, 0b0001, 2},
+		{1 << 63, 1, 2},
+		{0x0f0f0f0f0f0f0f0f, 0xf0f0f0f0f0f0f0f0, 64},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%#x, %#x) is %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Distance(tt.b, tt.a); got != tt.want {
+			t.Errorf("Distance(%#x, %#x) is %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestFormatParse(t *testing.T) {
+	for _, hash := range []uint64{0, 1, 0x8000000000000000, 0x0123456789abcdef} {
+		s := Format(hash)
+		if len(s) != 16 {
+			t.Errorf("Format(%#x) is %q, want 16 digits", hash, s)
+		}
+		got, err := Parse(s)
+		if err != nil || got != hash {
+			t.Errorf("Parse(%q) is %#x, %v, want %#x", s, got, err, hash)
+		}
+	}
+	for _, s := range []string{"", "xyz", "10123456789abcdef"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", s)
+		}
+	}
+}
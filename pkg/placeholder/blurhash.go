@@ -0,0 +1,106 @@
+package placeholder
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// blurHashSampleSize is the longest side of the copy the components are
+// computed from. BlurHash only keeps very low frequencies, so a small copy
+// gives the same hash much faster.
+const blurHashSampleSize = 64
+
+// base83Chars is the BlurHash base 83 alphabet
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes the image as a BlurHash string with xComponents by
+// yComponents cosine components, each between 1 and 9. See
+// https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+func BlurHash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("placeholder: blurhash components must be between 1 and 9, got %dx%d", xComponents, yComponents)
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return "", fmt.Errorf("placeholder: empty image")
+	}
+
+	pix, w, h := pixels(imaging.Fit(img, blurHashSampleSize, blurHashSampleSize, imaging.Box))
+
+	// Linearize once rather than per component
+	linear := make([][3]float64, len(pix))
+	for i, c := range pix {
+		linear[i] = [3]float64{sRGBToLinear(c.R), sRGBToLinear(c.G), sRGBToLinear(c.B)}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				cosY := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) * cosY
+					c := linear[y*w+x]
+					f[0] += basis * c[0]
+					f[1] += basis * c[1]
+					f[2] += basis * c[2]
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	encodeBase83(&sb, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, f := range ac {
+			actualMaximum = math.Max(actualMaximum, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		encodeBase83(&sb, quantisedMaximum, 1)
+	} else {
+		encodeBase83(&sb, 0, 1)
+	}
+
+	encodeBase83(&sb, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+
+	for _, f := range ac {
+		quantise := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		encodeBase83(&sb, quantise(f[0])*19*19+quantise(f[1])*19+quantise(f[2]), 2)
+	}
+
+	return sb.String(), nil
+}
+
+// encodeBase83 writes value as length base 83 digits, most significant first
+func encodeBase83(sb *strings.Builder, value, length int) {
+	divisor := 1
+	for i := 1; i < length; i++ {
+		divisor *= 83
+	}
+	for ; divisor > 0; divisor /= 83 {
+		sb.WriteByte(base83Chars[(value/divisor)%83])
+	}
+}
+
+// signPow raises the magnitude of v to exp, keeping its sign
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
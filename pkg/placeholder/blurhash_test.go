@@ -0,0 +1,60 @@
+package placeholder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// The expected hashes follow the reference encoder in the BlurHash
+// algorithm description, computed independently of this package
+func TestBlurHash(t *testing.T) {
+	red := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for i := 0; i < 12; i++ {
+		red.SetNRGBA(i%4, i/4, color.NRGBA{R: 255, A: 255})
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+		x, y int
+		want string
+	}{
+		{"solid red", red, 4, 3, "L~TI:j|cfQ|c|c$5fQ$5fQfQfQfQ"},
+		{"dc only", testPattern(32, 24, false), 1, 1, "00Hxyr"},
+		{"landscape", testPattern(32, 24, false), 4, 3, "L4Hxyr^+F@.j%iz_Ne:UTTF@xRX}"},
+		{"portrait", testPattern(20, 30, false), 3, 4, "T6HoB?.lAV?Hre$LELXf#T.8SbP3"},
+		{"alpha ignored", testPattern(24, 24, true), 4, 3, "L6Hxyr?bGQ.k%5nP#F#8KuSup9c7"},
+		{
+			"most components", testPattern(32, 24, false), 9, 9,
+			"|9Hxyr%MOUyBP4?GxAx]E$tTrvS4#BWUoHF=#ER%XeOUs%XhouOXSvS_kR=|e[OYJ5nTxCwOiyJ+CGxbX2-hK]S]KIo_Xz=hJ8cQQ@r1TXS#L?OBu:VbKMM5Qps;rHQ=mpPT$Mn4smacjbsRb@I:nPRjs*JAniSiV[nUNF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BlurHash(tt.img, tt.x, tt.y)
+			if err != nil {
+				t.Fatalf("BlurHash: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("BlurHash is %q, want %q", got, tt.want)
+			}
+			if wantLen := 4 + 2*tt.x*tt.y; len(got) != wantLen {
+				t.Errorf("length is %d, want %d", len(got), wantLen)
+			}
+		})
+	}
+}
+
+func TestBlurHashErrors(t *testing.T) {
+	img := testPattern(4, 4, false)
+	for _, c := range [][2]int{{0, 3}, {4, 0}, {10, 3}, {4, 10}} {
+		if _, err := BlurHash(img, c[0], c[1]); err == nil {
+			t.Errorf("BlurHash accepted %dx%d components", c[0], c[1])
+		}
+	}
+	if _, err := BlurHash(image.NewNRGBA(image.Rect(0, 0, 0, 0)), 4, 3); err == nil {
+		t.Errorf("BlurHash accepted an empty image")
+	}
+}
@@ -0,0 +1,71 @@
+// Package placeholder computes compact stand-ins for an image that clients
+// can show while the real image loads: BlurHash and ThumbHash strings and
+// tiny data URIs.
+package placeholder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// sRGBToLinear converts an 8-bit sRGB channel to linear light in [0, 1]
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts linear light to an 8-bit sRGB channel
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// DataURI encodes a copy of the image scaled to fit maxSize x maxSize as a
+// base64 data URI. Images with transparency are encoded as PNG, others as
+// JPEG, which is much smaller for photos.
+func DataURI(img image.Image, maxSize int) (string, error) {
+	if maxSize < 1 {
+		return "", fmt.Errorf("placeholder: invalid size %d", maxSize)
+	}
+	small := imaging.Fit(img, maxSize, maxSize, imaging.Box)
+
+	var buf bytes.Buffer
+	mimeType := "image/jpeg"
+	if !small.Opaque() {
+		mimeType = "image/png"
+		if err := png.Encode(&buf, small); err != nil {
+			return "", err
+		}
+	} else if err := jpeg.Encode(&buf, small, &jpeg.Options{Quality: 70}); err != nil {
+		return "", err
+	}
+
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// pixels returns the image as non-premultiplied pixels in row order
+func pixels(img image.Image) ([]color.NRGBA, int, int) {
+	nrgba := imaging.Clone(img)
+	w, h := nrgba.Bounds().Dx(), nrgba.Bounds().Dy()
+	pix := make([]color.NRGBA, 0, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pix = append(pix, nrgba.NRGBAAt(x, y))
+		}
+	}
+	return pix, w, h
+}
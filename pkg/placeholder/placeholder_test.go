@@ -0,0 +1,97 @@
+package placeholder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testPattern is a detailed image with no symmetry, so that no DCT term is
+// close to a rounding boundary and the hashes are stable across platforms
+func testPattern(w, h int, translucent bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{
+				R: uint8((x*37 + y*101 + x*y*13) % 256),
+				G: uint8((x*x*7 + y*29 + 91) % 256),
+				B: uint8((x*53 + y*y*11 + 17) % 256),
+				A: 255,
+			}
+			if translucent {
+				c.A = uint8((x*19+y*23+x*y*3)%200 + 55)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestDataURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		img      image.Image
+		maxSize  int
+		mimeType string
+		decode   func([]byte) (image.Image, error)
+		size     image.Point
+	}{
+		{
+			name:     "opaque landscape",
+			img:      testPattern(64, 32, false),
+			maxSize:  16,
+			mimeType: "image/jpeg",
+			decode:   func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) },
+			size:     image.Pt(16, 8),
+		},
+		{
+			name:     "translucent portrait",
+			img:      testPattern(30, 60, true),
+			maxSize:  16,
+			mimeType: "image/png",
+			decode:   func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) },
+			size:     image.Pt(8, 16),
+		},
+		{
+			name:     "smaller than the limit",
+			img:      testPattern(10, 6, false),
+			maxSize:  16,
+			mimeType: "image/jpeg",
+			decode:   func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) },
+			size:     image.Pt(10, 6),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri, err := DataURI(tt.img, tt.maxSize)
+			if err != nil {
+				t.Fatalf("DataURI: %v", err)
+			}
+			prefix := "data:" + tt.mimeType + ";base64,"
+			if !strings.HasPrefix(uri, prefix) {
+				t.Fatalf("data URI starts with %.30q, want %q", uri, prefix)
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, prefix))
+			if err != nil {
+				t.Fatalf("base64: %v", err)
+			}
+			img, err := tt.decode(data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if size := img.Bounds().Size(); size != tt.size {
+				t.Errorf("size is %v, want %v", size, tt.size)
+			}
+		})
+	}
+
+	if _, err := DataURI(testPattern(4, 4, false), 0); err == nil {
+		t.Errorf("DataURI accepted a zero size")
+	}
+}
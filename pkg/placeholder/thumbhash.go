@@ -0,0 +1,148 @@
+package placeholder
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// thumbHashMaxSize is the largest width or height ThumbHash encodes; larger
+// images are scaled down first
+const thumbHashMaxSize = 100
+
+// ThumbHash encodes the image as a ThumbHash. Unlike BlurHash it keeps the
+// aspect ratio and alpha. See https://evanw.github.io/thumbhash/
+func ThumbHash(img image.Image) ([]byte, error) {
+	if img.Bounds().Empty() {
+		return nil, fmt.Errorf("placeholder: empty image")
+	}
+	pix, w, h := pixels(imaging.Fit(img, thumbHashMaxSize, thumbHashMaxSize, imaging.Box))
+
+	// Average color, weighted by alpha
+	var avgR, avgG, avgB, avgA float64
+	for _, c := range pix {
+		alpha := float64(c.A) / 255
+		avgR += alpha / 255 * float64(c.R)
+		avgG += alpha / 255 * float64(c.G)
+		avgB += alpha / 255 * float64(c.B)
+		avgA += alpha
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+
+	hasAlpha := avgA < float64(w*h)
+	lLimit := 7.0
+	if hasAlpha {
+		// Fewer luminance components leave room for the alpha channel
+		lLimit = 5
+	}
+	longest := float64(max(w, h))
+	lx := max(1, int(math.Round(lLimit*float64(w)/longest)))
+	ly := max(1, int(math.Round(lLimit*float64(h)/longest)))
+
+	// Convert to luminance, yellow-blue, red-green and alpha channels,
+	// composited over the average color
+	l := make([]float64, len(pix))
+	p := make([]float64, len(pix))
+	q := make([]float64, len(pix))
+	a := make([]float64, len(pix))
+	for i, c := range pix {
+		alpha := float64(c.A) / 255
+		r := avgR*(1-alpha) + alpha/255*float64(c.R)
+		g := avgG*(1-alpha) + alpha/255*float64(c.G)
+		b := avgB*(1-alpha) + alpha/255*float64(c.B)
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	lDC, lAC, lScale := encodeChannel(l, w, h, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encodeChannel(p, w, h, 3, 3)
+	qDC, qAC, qScale := encodeChannel(q, w, h, 3, 3)
+
+	isLandscape := w > h
+	header24 := round(63*lDC) | round(31.5+31.5*pDC)<<6 | round(31.5+31.5*qDC)<<12 | round(31*lScale)<<18
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+	header16 := round(63*pScale)<<3 | round(63*qScale)<<9
+	if isLandscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+
+	hash := []byte{
+		byte(header24), byte(header24 >> 8), byte(header24 >> 16),
+		byte(header16), byte(header16 >> 8),
+	}
+
+	channels := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		aDC, aAC, aScale := encodeChannel(a, w, h, 5, 5)
+		hash = append(hash, byte(round(15*aDC)|round(15*aScale)<<4))
+		channels = append(channels, aAC)
+	}
+
+	// Pack the AC terms as 4-bit values, low nibble first
+	acStart := len(hash)
+	index := 0
+	for _, ac := range channels {
+		for _, f := range ac {
+			if acStart+index>>1 == len(hash) {
+				hash = append(hash, 0)
+			}
+			hash[acStart+index>>1] |= byte(round(15*f) << ((index & 1) << 2))
+			index++
+		}
+	}
+
+	return hash, nil
+}
+
+// encodeChannel computes the DCT of a channel, keeping the nx by ny
+// low-frequency terms in a triangle. The AC terms are normalized to [0, 1]
+// by the returned scale.
+func encodeChannel(channel []float64, w, h, nx, ny int) (float64, []float64, float64) {
+	var dc, scale float64
+	var ac []float64
+	fx := make([]float64, w)
+	for cy := 0; cy < ny; cy++ {
+		for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+			for x := 0; x < w; x++ {
+				fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+			}
+			f := 0.0
+			for y := 0; y < h; y++ {
+				fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+				for x := 0; x < w; x++ {
+					f += channel[x+y*w] * fx[x] * fy
+				}
+			}
+			f /= float64(w * h)
+			if cx > 0 || cy > 0 {
+				ac = append(ac, f)
+				scale = math.Max(scale, math.Abs(f))
+			} else {
+				dc = f
+			}
+		}
+	}
+	if scale > 0 {
+		for i := range ac {
+			ac[i] = 0.5 + 0.5/scale*ac[i]
+		}
+	}
+	return dc, ac, scale
+}
+
+// round rounds half up, matching JavaScript's Math.round
+func round(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
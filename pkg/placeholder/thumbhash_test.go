@@ -0,0 +1,51 @@
+package placeholder
+
+import (
+	"encoding/base64"
+	"image"
+	"testing"
+)
+
+// The expected hashes follow the reference JavaScript encoder
+// (rgbaToThumbHash), computed independently of this package
+func TestThumbHash(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want string
+	}{
+		{"landscape", testPattern(32, 24, false), "IAgCDYJYmG5wp1ZXlmlb5Vhzn0At"},
+		{"portrait", testPattern(20, 30, false), "IAgCBQIYLnabBZagg5txqGgIFJAc"},
+		{"square with alpha", testPattern(24, 24, true), "IAiCBQIJeftli2R5x7RAjGA4B0I3Jlqogw=="},
+		{"landscape with alpha", testPattern(30, 18, true), "IAiCC4IJbNUg/aKAhosF5ihVK0pNcwQ="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := ThumbHash(tt.img)
+			if err != nil {
+				t.Fatalf("ThumbHash: %v", err)
+			}
+			if got := base64.StdEncoding.EncodeToString(hash); got != tt.want {
+				t.Errorf("ThumbHash is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbHashDownscalesLargeImages(t *testing.T) {
+	hash, err := ThumbHash(testPattern(400, 100, false))
+	if err != nil {
+		t.Fatalf("ThumbHash: %v", err)
+	}
+	// The landscape flag and the luminance component count along the short
+	// side are in the second header
+	header16 := int(hash[3]) | int(hash[4])<<8
+	if header16>>15 != 1 || header16&7 != 2 {
+		t.Errorf("header is %#04x, want a landscape hash with 2 rows of luminance", header16)
+	}
+
+	if _, err := ThumbHash(image.NewNRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Errorf("ThumbHash accepted an empty image")
+	}
+}
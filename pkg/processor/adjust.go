@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// adjustImage applies the operation's brightness, contrast, gamma, saturation
+// and hue adjustments in that order, skipping any that are unset
+func adjustImage(img image.Image, op types.ImageOperation) image.Image {
+	result := img
+
+	if op.Brightness != 0 {
+		result = imaging.AdjustBrightness(result, op.Brightness)
+	}
+	if op.Contrast != 0 {
+		result = imaging.AdjustContrast(result, op.Contrast)
+	}
+	if op.Gamma != 0 && op.Gamma != 1 {
+		result = imaging.AdjustGamma(result, op.Gamma)
+	}
+	if op.Saturation != 0 {
+		result = imaging.AdjustSaturation(result, op.Saturation)
+	}
+	if op.Hue != 0 {
+		result = adjustHue(result, op.Hue)
+	}
+
+	return result
+}
+
+// adjustHue rotates the hue of every pixel by the given number of degrees
+func adjustHue(img image.Image, degrees float64) *image.NRGBA {
+	shift := degrees / 360
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		h, s, l := rgbToHSL(c.R, c.G, c.B)
+		h = math.Mod(h+shift+1, 1)
+		r, g, b := hslToRGB(h, s, l)
+		return color.NRGBA{R: r, G: g, B: b, A: c.A}
+	})
+}
+
+// rgbToHSL converts 8-bit RGB to hue, saturation and lightness in [0, 1]
+func rgbToHSL(r8, g8, b8 uint8) (h, s, l float64) {
+	r := float64(r8) / 255
+	g := float64(g8) / 255
+	b := float64(b8) / 255
+
+	maxC := math.Max(r, math.Max(g, b))
+	minC := math.Min(r, math.Min(g, b))
+	l = (maxC + minC) / 2
+
+	if maxC == minC {
+		return 0, 0, l
+	}
+
+	d := maxC - minC
+	if l > 0.5 {
+		s = d / (2 - maxC - minC)
+	} else {
+		s = d / (maxC + minC)
+	}
+
+	switch maxC {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+
+	return h / 6, s, l
+}
+
+// hslToRGB converts hue, saturation and lightness in [0, 1] to 8-bit RGB
+func hslToRGB(h, s, l float64) (r, g, b uint8) {
+	if s == 0 {
+		v := clampUint8(l * 255)
+		return v, v, v
+	}
+
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+
+	return clampUint8(hueToRGB(p, q, h+1.0/3) * 255),
+		clampUint8(hueToRGB(p, q, h) * 255),
+		clampUint8(hueToRGB(p, q, h-1.0/3) * 255)
+}
+
+// hueToRGB is the HSL helper that evaluates one channel
+func hueToRGB(p, q, t float64) float64 {
+	if t < 0 {
+		t++
+	}
+	if t > 1 {
+		t--
+	}
+	switch {
+	case t < 1.0/6:
+		return p + (q-p)*6*t
+	case t < 1.0/2:
+		return q
+	case t < 2.0/3:
+		return p + (q-p)*(2.0/3-t)*6
+	default:
+		return p
+	}
+}
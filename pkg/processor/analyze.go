@@ -0,0 +1,174 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+	"sort"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// analysisSampleSize is the longest side of the copy colors are
+	// counted on
+	analysisSampleSize = 100
+	// defaultPaletteSize is the number of dominant colors when the job
+	// options do not say
+	defaultPaletteSize = 5
+	// paletteRefinements is the number of k-means passes that refine the
+	// median cut palette
+	paletteRefinements = 5
+)
+
+// analyzeColors computes the average color and the dominant colors of the
+// image with their share of its opaque pixels. Nearly transparent pixels are
+// ignored so logos on transparent backgrounds report their ink colors.
+func analyzeColors(img image.Image, paletteSize int) (*types.ColorAnalysis, error) {
+	if paletteSize <= 0 {
+		paletteSize = defaultPaletteSize
+	}
+
+	small := imaging.Fit(img, analysisSampleSize, analysisSampleSize, imaging.Box)
+	var pixels [][3]float64
+	for i := 0; i < len(small.Pix); i += 4 {
+		if small.Pix[i+3] < 128 {
+			continue
+		}
+		pixels = append(pixels, [3]float64{float64(small.Pix[i]), float64(small.Pix[i+1]), float64(small.Pix[i+2])})
+	}
+	if len(pixels) == 0 {
+		return nil, fmt.Errorf("image has no opaque pixels")
+	}
+
+	var sum [3]float64
+	for _, px := range pixels {
+		sum[0] += px[0]
+		sum[1] += px[1]
+		sum[2] += px[2]
+	}
+	n := float64(len(pixels))
+	analysis := &types.ColorAnalysis{
+		AverageColor: formatColor(toNRGBA([3]float64{sum[0] / n, sum[1] / n, sum[2] / n})),
+	}
+
+	centroids := medianCut(pixels, paletteSize)
+	counts := make([]int, len(centroids))
+	for pass := 0; pass <= paletteRefinements; pass++ {
+		sums := make([][3]float64, len(centroids))
+		clear(counts)
+		for _, px := range pixels {
+			c := nearestCentroid(centroids, px)
+			sums[c][0] += px[0]
+			sums[c][1] += px[1]
+			sums[c][2] += px[2]
+			counts[c]++
+		}
+		if pass == paletteRefinements {
+			break
+		}
+		for c := range centroids {
+			if counts[c] > 0 {
+				k := float64(counts[c])
+				centroids[c] = [3]float64{sums[c][0] / k, sums[c][1] / k, sums[c][2] / k}
+			}
+		}
+	}
+
+	for c, centroid := range centroids {
+		if counts[c] == 0 {
+			continue
+		}
+		analysis.DominantColors = append(analysis.DominantColors, types.DominantColor{
+			Color:      formatColor(toNRGBA(centroid)),
+			Proportion: float64(counts[c]) / n,
+		})
+	}
+	sort.SliceStable(analysis.DominantColors, func(i, j int) bool {
+		return analysis.DominantColors[i].Proportion > analysis.DominantColors[j].Proportion
+	})
+
+	return analysis, nil
+}
+
+// medianCut splits the pixels into at most n boxes, each time halving the
+// box with the widest channel range at its median, and returns the mean
+// color of each box
+func medianCut(pixels [][3]float64, n int) [][3]float64 {
+	boxes := [][][3]float64{slices.Clone(pixels)}
+	for len(boxes) < n {
+		best, bestChannel, bestRange := -1, 0, 0.0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			channel, r := widestChannel(box)
+			if r > bestRange {
+				best, bestChannel, bestRange = i, channel, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return box[i][bestChannel] < box[j][bestChannel] })
+		mid := len(box) / 2
+		boxes[best] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	centroids := make([][3]float64, len(boxes))
+	for i, box := range boxes {
+		for _, px := range box {
+			centroids[i][0] += px[0]
+			centroids[i][1] += px[1]
+			centroids[i][2] += px[2]
+		}
+		k := float64(len(box))
+		centroids[i] = [3]float64{centroids[i][0] / k, centroids[i][1] / k, centroids[i][2] / k}
+	}
+	return centroids
+}
+
+// widestChannel returns the channel with the largest value range in the box
+// and that range
+func widestChannel(box [][3]float64) (int, float64) {
+	lo := [3]float64{255, 255, 255}
+	var hi [3]float64
+	for _, px := range box {
+		for c := 0; c < 3; c++ {
+			lo[c] = min(lo[c], px[c])
+			hi[c] = max(hi[c], px[c])
+		}
+	}
+
+	channel := 0
+	for c := 1; c < 3; c++ {
+		if hi[c]-lo[c] > hi[channel]-lo[channel] {
+			channel = c
+		}
+	}
+	return channel, hi[channel] - lo[channel]
+}
+
+// nearestCentroid returns the index of the centroid closest to px
+func nearestCentroid(centroids [][3]float64, px [3]float64) int {
+	best, bestDist := 0, -1.0
+	for i, c := range centroids {
+		dr, dg, db := c[0]-px[0], c[1]-px[1], c[2]-px[2]
+		dist := dr*dr + dg*dg + db*db
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// toNRGBA rounds an RGB triple to an opaque color
+func toNRGBA(rgb [3]float64) color.NRGBA {
+	return color.NRGBA{R: clampUint8(rgb[0]), G: clampUint8(rgb[1]), B: clampUint8(rgb[2]), A: 255}
+}
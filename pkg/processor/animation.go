@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"time"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/colornames"
+)
+
+// animatedOperations lists the operation types that are applied to every
+// frame of an animated GIF instead of only its first frame
+var animatedOperations = map[string]bool{
+	types.OpResize: true,
+	types.OpCrop:   true,
+	types.OpFormat: true,
+}
+
+// keepsAnimation reports whether the output should turn an animated source
+// into an animated GIF. Smart crops are excluded because each frame would
+// pick its own window.
+func keepsAnimation(src *sourceImage, spec types.OutputSpec) bool {
+	if src.animation == nil || spec.Format != types.FormatGIF {
+		return false
+	}
+	for _, step := range spec.Steps {
+		if !animatedOperations[step.Type] || step.Gravity == types.GravitySmart {
+			return false
+		}
+	}
+	return true
+}
+
+// frame returns the fully composited frame at index, for use as a poster
+// image. Still images only have frame 0.
+func (s *sourceImage) frame(index int) (image.Image, error) {
+	if s.animation == nil {
+		if index != 0 {
+			return nil, fmt.Errorf("frame %d is out of range, the image has 1 frame", index)
+		}
+		return s.image, nil
+	}
+
+	if index < 0 || index >= len(s.animation.Image) {
+		return nil, fmt.Errorf("frame %d is out of range, the animation has %d frames", index, len(s.animation.Image))
+	}
+	frames := coalesceFrames(s.animation, index+1)
+	return frames[index], nil
+}
+
+// applyToAnimation applies the steps to every frame, keeping the frame
+// delays and loop count, and records the frame count and total duration
+func (p *ImageProcessor) applyToAnimation(ctx context.Context, anim *gif.GIF, steps []types.ImageOperation, info *types.ProcessedImage) (*gif.GIF, error) {
+	frames := coalesceFrames(anim, len(anim.Image))
+	out := &gif.GIF{LoopCount: anim.LoopCount}
+
+	totalDelay := 0
+	for i, frame := range frames {
+		processed, err := p.applySteps(ctx, frame, steps, info)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		delay := 0
+		if i < len(anim.Delay) {
+			delay = anim.Delay[i]
+		}
+		totalDelay += delay
+
+		// Frames are full canvases, so each one replaces the previous
+		out.Image = append(out.Image, quantizeFrame(processed, anim.Image[i].Palette))
+		out.Delay = append(out.Delay, delay)
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+	}
+
+	info.FrameCount = len(out.Image)
+	info.Duration = time.Duration(totalDelay) * 10 * time.Millisecond
+
+	return out, nil
+}
+
+// uploadAnimation encodes and uploads an animated GIF. GIF has no quality
+// to lower, so an animation over the byte budget fails.
+func (p *ImageProcessor) uploadAnimation(ctx context.Context, anim *gif.GIF, spec types.OutputSpec) (string, int64, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return "", 0, fmt.Errorf("failed to encode animation: %w", err)
+	}
+	if spec.MaxBytes > 0 && int64(buf.Len()) > spec.MaxBytes {
+		return "", 0, fmt.Errorf("animation is %d bytes, over the max_bytes budget of %d", buf.Len(), spec.MaxBytes)
+	}
+	return p.uploadEncoded(ctx, &buf, spec)
+}
+
+// coalesceFrames renders the first count frames onto the full logical
+// screen, honoring each frame's disposal method, so every returned frame is
+// a complete picture
+func coalesceFrames(anim *gif.GIF, count int) []*image.NRGBA {
+	width, height := anim.Config.Width, anim.Config.Height
+	if width == 0 || height == 0 {
+		var bounds image.Rectangle
+		for _, frame := range anim.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+		width, height = bounds.Max.X, bounds.Max.Y
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	frames := make([]*image.NRGBA, 0, count)
+
+	for i := 0; i < count; i++ {
+		frame := anim.Image[i]
+		disposal := byte(0)
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, imaging.Clone(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames
+}
+
+// quantizeFrame converts a processed frame back to a paletted image using
+// the frame's original palette. Pixels that are mostly transparent become
+// fully transparent, since GIF has no partial transparency.
+func quantizeFrame(img image.Image, pal color.Palette) *image.Paletted {
+	frame := imaging.Clone(img)
+
+	hasTransparency := false
+	for i := 3; i < len(frame.Pix); i += 4 {
+		if frame.Pix[i] < 128 {
+			frame.Pix[i-3], frame.Pix[i-2], frame.Pix[i-1], frame.Pix[i] = 0, 0, 0, 0
+			hasTransparency = true
+		} else {
+			frame.Pix[i] = 255
+		}
+	}
+
+	colors := append(color.Palette(nil), pal...)
+	if len(colors) == 0 {
+		colors = color.Palette{colornames.Black, colornames.White}
+	}
+	if hasTransparency && !hasTransparentEntry(colors) {
+		if len(colors) < 256 {
+			colors = append(colors, color.NRGBA{})
+		} else {
+			colors[len(colors)-1] = color.NRGBA{}
+		}
+	}
+
+	dst := image.NewPaletted(frame.Bounds(), colors)
+	draw.FloydSteinberg.Draw(dst, dst.Bounds(), frame, image.Point{})
+	return dst
+}
+
+// hasTransparentEntry reports whether the palette contains a fully
+// transparent color
+func hasTransparentEntry(pal color.Palette) bool {
+	for _, c := range pal {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return true
+		}
+	}
+	return false
+}
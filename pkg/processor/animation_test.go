@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+	"time"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// testAnimation is a 40x20 GIF whose frames are solid red, green and blue
+// with delays of 10, 20 and 30 hundredths of a second
+func testAnimation() *gif.GIF {
+	anim := &gif.GIF{LoopCount: 3, Config: image.Config{Width: 40, Height: 20}}
+	for i, c := range []color.Color{color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}} {
+		frame := image.NewPaletted(image.Rect(0, 0, 40, 20), palette.WebSafe)
+		idx := uint8(frame.Palette.Index(c))
+		for j := range frame.Pix {
+			frame.Pix[j] = idx
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, (i+1)*10)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	return anim
+}
+
+func TestApplyToAnimation(t *testing.T) {
+	tests := []struct {
+		name     string
+		steps    []types.ImageOperation
+		wantSize image.Point
+	}{
+		{
+			name:     "no steps",
+			wantSize: image.Pt(40, 20),
+		},
+		{
+			name:     "resize",
+			steps:    []types.ImageOperation{{Type: types.OpResize, Width: 20}},
+			wantSize: image.Pt(20, 10),
+		},
+		{
+			name:     "crop",
+			steps:    []types.ImageOperation{{Type: types.OpCrop, X: 5, Y: 5, Width: 10, Height: 8}},
+			wantSize: image.Pt(10, 8),
+		},
+		{
+			name:     "cover",
+			steps:    []types.ImageOperation{{Type: types.OpResize, Width: 16, Height: 16, Fit: types.FitCover}},
+			wantSize: image.Pt(16, 16),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info types.ProcessedImage
+			out, err := (&ImageProcessor{}).applyToAnimation(context.Background(), testAnimation(), tt.steps, &info)
+			if err != nil {
+				t.Fatalf("applyToAnimation: %v", err)
+			}
+
+			// Round trip through the encoder so the check covers what is uploaded
+			var buf bytes.Buffer
+			if err := gif.EncodeAll(&buf, out); err != nil {
+				t.Fatalf("gif.EncodeAll: %v", err)
+			}
+			decoded, err := gif.DecodeAll(&buf)
+			if err != nil {
+				t.Fatalf("gif.DecodeAll: %v", err)
+			}
+
+			if len(decoded.Image) != 3 || info.FrameCount != 3 {
+				t.Fatalf("got %d frames with FrameCount %d, want 3", len(decoded.Image), info.FrameCount)
+			}
+			for i, want := range []int{10, 20, 30} {
+				if decoded.Delay[i] != want {
+					t.Errorf("frame %d delay is %d, want %d", i, decoded.Delay[i], want)
+				}
+				if size := decoded.Image[i].Bounds().Size(); size != tt.wantSize {
+					t.Errorf("frame %d size is %v, want %v", i, size, tt.wantSize)
+				}
+			}
+			if info.Duration != 600*time.Millisecond {
+				t.Errorf("duration is %v, want %v", info.Duration, 600*time.Millisecond)
+			}
+			if decoded.LoopCount != 3 {
+				t.Errorf("loop count is %d, want 3", decoded.LoopCount)
+			}
+
+			// Each frame keeps its own color
+			for i, want := range []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}} {
+				center := decoded.Image[i].Bounds().Size().Div(2)
+				if got := color.NRGBAModel.Convert(decoded.Image[i].At(center.X, center.Y)); got != want {
+					t.Errorf("frame %d center is %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeepsAnimation(t *testing.T) {
+	animated := &sourceImage{image: image.NewNRGBA(image.Rect(0, 0, 40, 20)), animation: testAnimation()}
+	still := &sourceImage{image: image.NewNRGBA(image.Rect(0, 0, 40, 20))}
+
+	tests := []struct {
+		name string
+		src  *sourceImage
+		spec types.OutputSpec
+		want bool
+	}{
+		{"gif output", animated, types.OutputSpec{Format: types.FormatGIF}, true},
+		{"resize and crop", animated, types.OutputSpec{Format: types.FormatGIF, Steps: []types.ImageOperation{{Type: types.OpResize, Width: 20}, {Type: types.OpCrop, Width: 10, Height: 10}}}, true},
+		{"still source", still, types.OutputSpec{Format: types.FormatGIF}, false},
+		{"png output", animated, types.OutputSpec{Format: types.FormatPNG}, false},
+		{"smart crop", animated, types.OutputSpec{Format: types.FormatGIF, Steps: []types.ImageOperation{{Type: types.OpCrop, Width: 10, Height: 10, Gravity: types.GravitySmart}}}, false},
+		{"watermark", animated, types.OutputSpec{Format: types.FormatGIF, Steps: []types.ImageOperation{{Type: types.OpWatermark, Watermark: "x"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keepsAnimation(tt.src, tt.spec); got != tt.want {
+				t.Errorf("keepsAnimation is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
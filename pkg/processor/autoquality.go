@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"event-driven-image-pipeline/pkg/metadata"
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// defaultMinSSIM is the similarity auto quality aims for when the output
+	// does not set one; above it JPEG artifacts are hard to notice
+	defaultMinSSIM = 0.98
+	// minAutoQuality and maxAutoQuality bound the auto quality search
+	minAutoQuality = 10
+	maxAutoQuality = 95
+	// ssimWindow and ssimStep are the size and spacing of the SSIM windows
+	ssimWindow = 8
+	ssimStep   = 4
+)
+
+// chooseAutoQuality finds the lowest JPEG quality, up to spec.Quality when
+// set, whose decoded output keeps an SSIM of at least spec.MinSSIM against
+// the image. If no quality reaches it, the highest one is used. It returns
+// the quality and its SSIM.
+func chooseAutoQuality(img image.Image, spec types.OutputSpec) (int, float64, error) {
+	threshold := spec.MinSSIM
+	if threshold == 0 {
+		threshold = defaultMinSSIM
+	}
+	hi := maxAutoQuality
+	if spec.Quality > 0 {
+		hi = spec.Quality
+	}
+
+	reference := lumaPlane(img)
+	score := func(quality int) (float64, error) {
+		// Metadata does not change the pixels, so it is left out here
+		encoded, err := encodeImage(img, types.FormatJPEG, quality, metadata.Raw{})
+		if err != nil {
+			return 0, err
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode quality %d candidate: %w", quality, err)
+		}
+		return ssim(reference, lumaPlane(decoded)), nil
+	}
+
+	best := hi
+	bestScore, err := score(hi)
+	if err != nil || bestScore < threshold {
+		return best, bestScore, err
+	}
+
+	// Binary search for the lowest passing quality, assuming the similarity
+	// grows with the quality
+	lo := min(minAutoQuality, best)
+	hi = best - 1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		s, err := score(mid)
+		if err != nil {
+			return 0, 0, err
+		}
+		if s >= threshold {
+			best, bestScore = mid, s
+			hi = mid - 1
+		} else {
+			lo = mid + 1
+		}
+	}
+	return best, bestScore, nil
+}
+
+// lumaValues is a plane of BT.601 luma values, the Y of JPEG's YCbCr
+type lumaValues struct {
+	width, height int
+	pix           []float64
+}
+
+// lumaPlane extracts the luma of an image, reading the Y plane directly for
+// decoded JPEGs
+func lumaPlane(img image.Image) lumaValues {
+	bounds := img.Bounds()
+	l := lumaValues{width: bounds.Dx(), height: bounds.Dy(), pix: make([]float64, bounds.Dx()*bounds.Dy())}
+
+	if ycc, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < l.height; y++ {
+			for x := 0; x < l.width; x++ {
+				l.pix[y*l.width+x] = float64(ycc.Y[ycc.YOffset(bounds.Min.X+x, bounds.Min.Y+y)])
+			}
+		}
+		return l
+	}
+
+	nrgba := imaging.Clone(img)
+	for y := 0; y < l.height; y++ {
+		for x := 0; x < l.width; x++ {
+			i := y*nrgba.Stride + x*4
+			r, g, b := float64(nrgba.Pix[i]), float64(nrgba.Pix[i+1]), float64(nrgba.Pix[i+2])
+			l.pix[y*l.width+x] = 0.299*r + 0.587*g + 0.114*b
+		}
+	}
+	return l
+}
+
+// ssim computes the mean structural similarity of two equally sized luma
+// planes over overlapping square windows
+func ssim(a, b lumaValues) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	window := min(ssimWindow, a.width, a.height)
+	if window == 0 || a.width != b.width || a.height != b.height {
+		return 0
+	}
+
+	var total float64
+	count := 0
+	for y0 := 0; y0+window <= a.height; y0 += ssimStep {
+		for x0 := 0; x0+window <= a.width; x0 += ssimStep {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y0+window; y++ {
+				row := y * a.width
+				for x := x0; x < x0+window; x++ {
+					va, vb := a.pix[row+x], b.pix[row+x]
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+				}
+			}
+
+			n := float64(window * window)
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			cov := sumAB/n - meanA*meanB
+
+			total += (2*meanA*meanB + c1) * (2*cov + c2) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			count++
+		}
+	}
+	return total / float64(count)
+}
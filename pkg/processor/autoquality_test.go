@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/metadata"
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// gradientImage is a smooth image that JPEG keeps close to the original even
+// at low quality
+func gradientImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// jpegSSIM encodes img at quality and returns the SSIM of the decoded result
+func jpegSSIM(t *testing.T, img image.Image, quality int) float64 {
+	t.Helper()
+	encoded, err := encodeImage(img, types.FormatJPEG, quality, metadata.Raw{})
+	if err != nil {
+		t.Fatalf("encodeImage: %v", err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+	return ssim(lumaPlane(img), lumaPlane(decoded))
+}
+
+func TestChooseAutoQuality(t *testing.T) {
+	smooth := gradientImage(128, 128)
+	noisy := noiseImage(128, 128)
+
+	tests := []struct {
+		name        string
+		img         image.Image
+		spec        types.OutputSpec
+		wantQuality func(int) bool
+		wantPass    bool
+	}{
+		{
+			name:        "smooth image at the default threshold",
+			img:         smooth,
+			spec:        types.OutputSpec{},
+			wantQuality: func(q int) bool { return q < 50 },
+			wantPass:    true,
+		},
+		{
+			name:        "detailed image at the default threshold",
+			img:         noisy,
+			spec:        types.OutputSpec{},
+			wantQuality: func(q int) bool { return q > 50 && q <= maxAutoQuality },
+			wantPass:    true,
+		},
+		{
+			name:        "lenient threshold",
+			img:         noisy,
+			spec:        types.OutputSpec{MinSSIM: 0.5},
+			wantQuality: func(q int) bool { return q < 50 },
+			wantPass:    true,
+		},
+		{
+			name:        "capped by the requested quality",
+			img:         smooth,
+			spec:        types.OutputSpec{Quality: 5},
+			wantQuality: func(q int) bool { return q <= 5 },
+		},
+		{
+			name:        "unreachable threshold uses the highest quality",
+			img:         noisy,
+			spec:        types.OutputSpec{Quality: 60, MinSSIM: 1},
+			wantQuality: func(q int) bool { return q == 60 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quality, score, err := chooseAutoQuality(tt.img, tt.spec)
+			if err != nil {
+				t.Fatalf("chooseAutoQuality: %v", err)
+			}
+			if !tt.wantQuality(quality) {
+				t.Errorf("quality is %d", quality)
+			}
+			if got := jpegSSIM(t, tt.img, quality); got != score {
+				t.Errorf("ssim is %v, want %v as measured", score, got)
+			}
+
+			threshold := tt.spec.MinSSIM
+			if threshold == 0 {
+				threshold = defaultMinSSIM
+			}
+			if !tt.wantPass {
+				return
+			}
+			if score < threshold {
+				t.Errorf("ssim is %v, want at least %v", score, threshold)
+			}
+			// The next lower quality would not have kept the threshold
+			if quality > minAutoQuality {
+				if lower := jpegSSIM(t, tt.img, quality-1); lower >= threshold {
+					t.Errorf("quality %d also keeps ssim %v, want the lowest passing quality", quality-1, lower)
+				}
+			}
+		})
+	}
+}
+
+func TestSSIM(t *testing.T) {
+	img := gradientImage(32, 32)
+	if got := ssim(lumaPlane(img), lumaPlane(img)); got != 1 {
+		t.Errorf("ssim of identical images is %v, want 1", got)
+	}
+	if got := ssim(lumaPlane(img), lumaPlane(noiseImage(32, 32))); got > 0.5 {
+		t.Errorf("ssim of unrelated images is %v, want at most 0.5", got)
+	}
+	if got := ssim(lumaPlane(img), lumaPlane(gradientImage(16, 32))); got != 0 {
+		t.Errorf("ssim of differently sized images is %v, want 0", got)
+	}
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"event-driven-image-pipeline/pkg/metadata"
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// minBudgetQuality is the lowest JPEG quality tried to meet a byte budget
+	minBudgetQuality = 10
+	// maxDownscaleSteps bounds how often an image is shrunk to meet a budget
+	maxDownscaleSteps = 8
+	// downscaleMargin undershoots the size estimate for each downscale so
+	// that a budget is usually met in one step
+	downscaleMargin = 0.9
+)
+
+// encodeWithinBudget encodes the image at the highest JPEG quality, up to
+// the requested one, whose output fits in spec.MaxBytes. Lossless formats
+// have no quality to lower. If even the lowest quality is too large and
+// AllowDownscale is set, the image is shrunk in proportion to the overshoot
+// and the search repeats. It returns the encoded bytes, the image that was
+// encoded and its quality.
+func encodeWithinBudget(img image.Image, spec types.OutputSpec, quality int, raw metadata.Raw) ([]byte, image.Image, int, error) {
+	for step := 0; ; step++ {
+		encoded, q, err := searchQuality(img, spec, quality, raw)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if int64(len(encoded)) <= spec.MaxBytes {
+			return encoded, img, q, nil
+		}
+
+		bounds := img.Bounds()
+		if !spec.AllowDownscale || step == maxDownscaleSteps || (bounds.Dx() == 1 && bounds.Dy() == 1) {
+			return nil, nil, 0, fmt.Errorf("smallest encoding is %d bytes at %dx%d, over the max_bytes budget of %d",
+				len(encoded), bounds.Dx(), bounds.Dy(), spec.MaxBytes)
+		}
+
+		// Encoded size grows roughly with the pixel count
+		scale := math.Sqrt(float64(spec.MaxBytes)/float64(len(encoded))) * downscaleMargin
+		width := max(1, int(float64(bounds.Dx())*scale))
+		height := max(1, int(float64(bounds.Dy())*scale))
+		img = imaging.Resize(img, width, height, imaging.Lanczos)
+	}
+}
+
+// searchQuality returns the encoding at the highest quality up to the
+// requested one that fits the budget, or the lowest quality encoding when
+// none does. Lossless formats are encoded once.
+func searchQuality(img image.Image, spec types.OutputSpec, quality int, raw metadata.Raw) ([]byte, int, error) {
+	encoded, err := encodeImage(img, spec.Format, quality, raw)
+	if err != nil || spec.Format != types.FormatJPEG || int64(len(encoded)) <= spec.MaxBytes {
+		return encoded, quality, err
+	}
+
+	// Binary search, assuming the size grows with the quality
+	var best []byte
+	bestQuality := 0
+	lo, hi := minBudgetQuality, quality-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		candidate, err := encodeImage(img, spec.Format, mid, raw)
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(candidate)) <= spec.MaxBytes {
+			best, bestQuality = candidate, mid
+			lo = mid + 1
+		} else {
+			encoded, quality = candidate, mid
+			hi = mid - 1
+		}
+	}
+	if best != nil {
+		return best, bestQuality, nil
+	}
+	return encoded, quality, nil
+}
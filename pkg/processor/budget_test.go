@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/metadata"
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// noiseImage is a detailed image that JPEG cannot compress well, so its
+// size depends strongly on the quality
+func noiseImage(width, height int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+func TestEncodeWithinBudget(t *testing.T) {
+	img := noiseImage(256, 256)
+	full, err := encodeImage(img, types.FormatJPEG, defaultQuality, metadata.Raw{})
+	if err != nil {
+		t.Fatalf("encodeImage: %v", err)
+	}
+	lowest, err := encodeImage(img, types.FormatJPEG, minBudgetQuality, metadata.Raw{})
+	if err != nil {
+		t.Fatalf("encodeImage: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		maxBytes       int64
+		allowDownscale bool
+		wantQuality    func(int) bool
+		wantSize       image.Point
+		wantErr        bool
+	}{
+		{
+			name:        "fits at the requested quality",
+			maxBytes:    int64(len(full)),
+			wantQuality: func(q int) bool { return q == defaultQuality },
+			wantSize:    image.Pt(256, 256),
+		},
+		{
+			name:        "fits at a lower quality",
+			maxBytes:    int64(len(full)+len(lowest)) / 2,
+			wantQuality: func(q int) bool { return q > minBudgetQuality && q < defaultQuality },
+			wantSize:    image.Pt(256, 256),
+		},
+		{
+			name:     "too small without downscaling",
+			maxBytes: int64(len(lowest)) - 1,
+			wantErr:  true,
+		},
+		{
+			name:           "fits after downscaling",
+			maxBytes:       int64(len(lowest)) / 2,
+			allowDownscale: true,
+			wantQuality:    func(q int) bool { return q >= minBudgetQuality },
+		},
+		{
+			name:           "too small for a single pixel",
+			maxBytes:       10,
+			allowDownscale: true,
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := types.OutputSpec{Format: types.FormatJPEG, MaxBytes: tt.maxBytes, AllowDownscale: tt.allowDownscale}
+			encoded, out, quality, err := encodeWithinBudget(img, spec, defaultQuality, metadata.Raw{})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "max_bytes") {
+					t.Fatalf("error is %v, want one naming the max_bytes budget", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encodeWithinBudget: %v", err)
+			}
+			if int64(len(encoded)) > tt.maxBytes {
+				t.Errorf("encoded %d bytes, over the budget of %d", len(encoded), tt.maxBytes)
+			}
+			if !tt.wantQuality(quality) {
+				t.Errorf("quality is %d", quality)
+			}
+			size := out.Bounds().Size()
+			if tt.wantSize != (image.Point{}) && size != tt.wantSize {
+				t.Errorf("size is %v, want %v", size, tt.wantSize)
+			}
+			if tt.allowDownscale && (size.X >= 256 || size.Y >= 256) {
+				t.Errorf("size is %v, want a downscaled image", size)
+			}
+		})
+	}
+}
+
+func TestProcessJobReportsBudgetFailure(t *testing.T) {
+	var source bytes.Buffer
+	if err := png.Encode(&source, noiseImage(64, 64)); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+
+	// One server plays both the image host and the object storage
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write(source.Bytes())
+		case http.MethodPut:
+			io.Copy(io.Discard, r.Body)
+			uploads.Add(1)
+			w.Header().Set("ETag", `"0"`)
+		}
+	}))
+	defer server.Close()
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatalf("minio.New: %v", err)
+	}
+	p := NewImageProcessor(client, "images")
+
+	job := &types.Job{
+		ID:       "job",
+		ImageURL: server.URL + "/source.png",
+		Outputs: []types.OutputSpec{
+			{Format: types.FormatJPEG, MaxBytes: 1 << 20},
+			{Format: types.FormatJPEG, MaxBytes: 100},
+		},
+	}
+	if err := p.ProcessJob(context.Background(), job); err != nil {
+		t.Fatalf("ProcessJob: %v", err)
+	}
+
+	if job.Status != types.StatusCompleted {
+		t.Errorf("status is %q, want %q", job.Status, types.StatusCompleted)
+	}
+	if len(job.Results) != 1 || uploads.Load() != 1 {
+		t.Errorf("got %d results and %d uploads, want 1 and 1", len(job.Results), uploads.Load())
+	}
+	if len(job.Errors) != 1 || job.Errors[0].Output != "outputs[1]" || !strings.Contains(job.Errors[0].Error, "max_bytes") {
+		t.Errorf("errors are %+v, want the budget failure of outputs[1]", job.Errors)
+	}
+
+	// A job whose only output fails is failed as a whole
+	job = &types.Job{
+		ID:       "job",
+		ImageURL: server.URL + "/source.png",
+		Outputs:  []types.OutputSpec{{Format: types.FormatJPEG, MaxBytes: 100}},
+	}
+	if err := p.ProcessJob(context.Background(), job); err == nil {
+		t.Errorf("ProcessJob succeeded without any output")
+	}
+	if len(job.Errors) != 1 {
+		t.Errorf("errors are %+v, want the budget failure", job.Errors)
+	}
+}
@@ -0,0 +1,44 @@
+package processor
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// parseColor parses a hex color in #rgb, #rrggbb or #rrggbbaa form.
+// An empty string yields the fallback color.
+func parseColor(s string, fallback color.NRGBA) (color.NRGBA, error) {
+	if s == "" {
+		return fallback, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	return color.NRGBA{
+		R: uint8(v >> 24),
+		G: uint8(v >> 16),
+		B: uint8(v >> 8),
+		A: uint8(v),
+	}, nil
+}
+
+// formatColor formats a color as #rrggbb, ignoring alpha
+func formatColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// gravityOffsets maps crop gravity names to the fraction of the spare width
+// and height that is left before the crop rectangle
+var gravityOffsets = map[string][2]float64{
+	types.GravityCenter:    {0.5, 0.5},
+	types.GravityNorth:     {0.5, 0},
+	types.GravityNorthEast: {1, 0},
+	types.GravityEast:      {1, 0.5},
+	types.GravitySouthEast: {1, 1},
+	types.GravitySouth:     {0.5, 1},
+	types.GravitySouthWest: {0, 1},
+	types.GravityWest:      {0, 0.5},
+	types.GravityNorthWest: {0, 0},
+}
+
+// cropImage crops either the explicit X/Y/Width/Height rectangle or, when a
+// gravity is given, a Width x Height region anchored at that gravity or, for
+// smart gravity, placed on the most detailed area. The image is never
+// resampled. It returns the cropped image and the kept rectangle relative to
+// the source.
+func cropImage(img image.Image, op types.ImageOperation) (image.Image, image.Rectangle, error) {
+	if op.Width <= 0 || op.Height <= 0 {
+		return nil, image.Rectangle{}, fmt.Errorf("crop requires a positive width and height, got %dx%d", op.Width, op.Height)
+	}
+
+	bounds := img.Bounds()
+	var rect image.Rectangle
+
+	switch op.Gravity {
+	case "":
+		rect = image.Rect(op.X, op.Y, op.X+op.Width, op.Y+op.Height)
+		if op.X < 0 || op.Y < 0 || !rect.In(image.Rect(0, 0, bounds.Dx(), bounds.Dy())) {
+			return nil, image.Rectangle{}, fmt.Errorf("crop rectangle %dx%d at (%d,%d) is outside the %dx%d image",
+				op.Width, op.Height, op.X, op.Y, bounds.Dx(), bounds.Dy())
+		}
+	default:
+		if op.Width > bounds.Dx() || op.Height > bounds.Dy() {
+			return nil, image.Rectangle{}, fmt.Errorf("crop size %dx%d is larger than the %dx%d image",
+				op.Width, op.Height, bounds.Dx(), bounds.Dy())
+		}
+		if op.Gravity == types.GravitySmart {
+			rect = smartCropWindow(img, op.Width, op.Height)
+			break
+		}
+		offsets, ok := gravityOffsets[op.Gravity]
+		if !ok {
+			return nil, image.Rectangle{}, fmt.Errorf("unknown crop gravity %q", op.Gravity)
+		}
+		x := int(float64(bounds.Dx()-op.Width) * offsets[0])
+		y := int(float64(bounds.Dy()-op.Height) * offsets[1])
+		rect = image.Rect(x, y, x+op.Width, y+op.Height)
+	}
+
+	return imaging.Crop(img, rect.Add(bounds.Min)), rect, nil
+}
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"log"
+
+	"event-driven-image-pipeline/pkg/icc"
+	"event-driven-image-pipeline/pkg/metadata"
+
+	"github.com/disintegration/imaging"
+
+	// Register the WebP decoder alongside the formats imaging already
+	// registers (JPEG, PNG, GIF, BMP and TIFF)
+	_ "golang.org/x/image/webp"
+)
+
+// supportedInputFormats lists the source formats the worker can decode,
+// keyed by the name reported by image.DecodeConfig
+var supportedInputFormats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+	"bmp":  true,
+	"tiff": true,
+	"webp": true,
+}
+
+// sourceImage is a decoded source image along with its original bytes
+type sourceImage struct {
+	image        image.Image
+	format       string
+	data         []byte
+	animation    *gif.GIF // every frame, set only for GIFs with more than one frame
+	autoOriented bool     // the EXIF orientation was applied to the pixels
+}
+
+// decodeImage reads the whole source, confirms it is in a supported format
+// and decodes it to sRGB using any embedded ICC profile, optionally applying
+// the EXIF orientation. CMYK JPEGs without a profile keep the standard
+// library's naive conversion, as no press profile is bundled.
+func decodeImage(r io.Reader, autoOrient bool) (*sourceImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized image format: %w", err)
+	}
+	if !supportedInputFormats[format] {
+		return nil, fmt.Errorf("unsupported image format %q", format)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw := metadata.Read(data, format)
+
+	// Every later step and output assumes sRGB, so colors are converted
+	// before the orientation flips and rotations resample them
+	if raw.ICC != nil {
+		converted, err := convertToSRGB(img, raw.ICC)
+		if err != nil {
+			log.Printf("Failed to apply the embedded color profile: %v", err)
+		} else {
+			img = converted
+		}
+	} else if _, ok := img.(*image.CMYK); ok {
+		log.Printf("CMYK source has no color profile, colors may be off")
+	}
+
+	// Only the orientation of JPEG files is applied, as imaging does
+	autoOriented := autoOrient && format == "jpeg"
+	if autoOriented {
+		img = applyOrientation(img, raw.EXIF)
+	}
+
+	src := &sourceImage{image: img, format: format, data: data, autoOriented: autoOriented}
+
+	if format == "gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(anim.Image) > 1 {
+			src.animation = anim
+		}
+	}
+
+	return src, nil
+}
+
+// convertToSRGB converts the pixels from the color space of an ICC profile
+// to sRGB. Images already in sRGB are returned unchanged.
+func convertToSRGB(img image.Image, profile []byte) (image.Image, error) {
+	p, err := icc.Parse(profile)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsSRGB() {
+		return img, nil
+	}
+	return p.ToSRGB(img)
+}
+
+// applyOrientation flips and rotates the image so that it displays upright
+// according to the EXIF orientation tag
+func applyOrientation(img image.Image, exif []byte) image.Image {
+	if exif == nil {
+		return img
+	}
+	data, _, err := metadata.ParseEXIF(exif)
+	if err != nil {
+		return img
+	}
+
+	switch data.Orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// applyEffect applies the operation's stylistic effect. All effects use
+// integer arithmetic so the same input always produces identical bytes.
+func applyEffect(img image.Image, op types.ImageOperation) (image.Image, error) {
+	switch op.Effect {
+	case types.EffectGrayscale:
+		return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+			l := luma(c)
+			return color.NRGBA{R: l, G: l, B: l, A: c.A}
+		}), nil
+
+	case types.EffectSepia:
+		return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+			r, g, b := int(c.R), int(c.G), int(c.B)
+			return color.NRGBA{
+				R: clampChannel((393*r + 769*g + 189*b + 500) / 1000),
+				G: clampChannel((349*r + 686*g + 168*b + 500) / 1000),
+				B: clampChannel((272*r + 534*g + 131*b + 500) / 1000),
+				A: c.A,
+			}
+		}), nil
+
+	case types.EffectInvert:
+		return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+			return color.NRGBA{R: 255 - c.R, G: 255 - c.G, B: 255 - c.B, A: c.A}
+		}), nil
+
+	case types.EffectDuotone:
+		shadow, err := parseColor(op.ShadowColor, color.NRGBA{A: 255})
+		if err != nil {
+			return nil, err
+		}
+		highlight, err := parseColor(op.HighlightColor, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+		if err != nil {
+			return nil, err
+		}
+		return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+			l := int(luma(c))
+			return color.NRGBA{
+				R: mixChannel(shadow.R, highlight.R, l),
+				G: mixChannel(shadow.G, highlight.G, l),
+				B: mixChannel(shadow.B, highlight.B, l),
+				A: c.A,
+			}
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unknown effect %q", op.Effect)
+	}
+}
+
+// luma returns the Rec. 601 luma of a color, rounded to the nearest integer
+func luma(c color.NRGBA) uint8 {
+	return uint8((299*int(c.R) + 587*int(c.G) + 114*int(c.B) + 500) / 1000)
+}
+
+// mixChannel interpolates between two channel values, t in [0, 255]
+func mixChannel(from, to uint8, t int) uint8 {
+	return uint8((int(from)*(255-t) + int(to)*t + 127) / 255)
+}
+
+// clampChannel limits v to [0, 255]
+func clampChannel(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
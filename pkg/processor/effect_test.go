@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// effectInput is a 2x2 image covering a color, black, translucent white and
+// a mostly transparent color
+var effectInput = []color.NRGBA{
+	{R: 200, G: 100, B: 50, A: 255},
+	{R: 0, G: 0, B: 0, A: 255},
+	{R: 255, G: 255, B: 255, A: 128},
+	{R: 10, G: 200, B: 30, A: 64},
+}
+
+func TestApplyEffectGolden(t *testing.T) {
+	tests := []struct {
+		op   types.ImageOperation
+		want []color.NRGBA
+	}{
+		{
+			op: types.ImageOperation{Effect: types.EffectGrayscale},
+			want: []color.NRGBA{
+				{R: 124, G: 124, B: 124, A: 255},
+				{R: 0, G: 0, B: 0, A: 255},
+				{R: 255, G: 255, B: 255, A: 128},
+				{R: 124, G: 124, B: 124, A: 64},
+			},
+		},
+		{
+			op: types.ImageOperation{Effect: types.EffectSepia},
+			want: []color.NRGBA{
+				{R: 165, G: 147, B: 114, A: 255},
+				{R: 0, G: 0, B: 0, A: 255},
+				{R: 255, G: 255, B: 239, A: 128},
+				{R: 163, G: 146, B: 113, A: 64},
+			},
+		},
+		{
+			op: types.ImageOperation{Effect: types.EffectInvert},
+			want: []color.NRGBA{
+				{R: 55, G: 155, B: 205, A: 255},
+				{R: 255, G: 255, B: 255, A: 255},
+				{R: 0, G: 0, B: 0, A: 128},
+				{R: 245, G: 55, B: 225, A: 64},
+			},
+		},
+		{
+			op: types.ImageOperation{Effect: types.EffectDuotone},
+			want: []color.NRGBA{
+				{R: 124, G: 124, B: 124, A: 255},
+				{R: 0, G: 0, B: 0, A: 255},
+				{R: 255, G: 255, B: 255, A: 128},
+				{R: 124, G: 124, B: 124, A: 64},
+			},
+		},
+		{
+			op: types.ImageOperation{Effect: types.EffectDuotone, ShadowColor: "#1e3264", HighlightColor: "#ffc850"},
+			want: []color.NRGBA{
+				{R: 139, G: 123, B: 90, A: 255},
+				{R: 30, G: 50, B: 100, A: 255},
+				{R: 255, G: 200, B: 80, A: 128},
+				{R: 139, G: 123, B: 90, A: 64},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		name := tt.op.Effect
+		if tt.op.ShadowColor != "" {
+			name += " colored"
+		}
+		t.Run(name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+			for i, c := range effectInput {
+				img.SetNRGBA(i%2, i/2, c)
+			}
+
+			out, err := applyEffect(img, tt.op)
+			if err != nil {
+				t.Fatalf("applyEffect: %v", err)
+			}
+			got := imaging.Clone(out)
+			for i, want := range tt.want {
+				if c := got.NRGBAAt(i%2, i/2); c != want {
+					t.Errorf("pixel %d is %v, want %v", i, c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEffectErrors(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	for _, op := range []types.ImageOperation{
+		{Effect: "posterize"},
+		{Effect: types.EffectDuotone, ShadowColor: "navy"},
+		{Effect: types.EffectDuotone, HighlightColor: "#12345"},
+	} {
+		if _, err := applyEffect(img, op); err == nil {
+			t.Errorf("applyEffect(%+v) succeeded, want an error", op)
+		}
+	}
+}
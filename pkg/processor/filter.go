@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"image"
+	"math"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// defaultFilterValue returns v, or 1 when it is unset
+func defaultFilterValue(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	return v
+}
+
+// blurImage applies a Gaussian blur with the operation's sigma
+func blurImage(img image.Image, op types.ImageOperation) image.Image {
+	return imaging.Blur(img, defaultFilterValue(op.Sigma))
+}
+
+// sharpenImage applies imaging's sharpen filter with the operation's sigma
+func sharpenImage(img image.Image, op types.ImageOperation) image.Image {
+	return imaging.Sharpen(img, defaultFilterValue(op.Sigma))
+}
+
+// unsharpMask sharpens the image by adding back the difference between the
+// image and a blurred copy. Channel differences smaller than the threshold
+// are left untouched so flat areas do not pick up noise.
+func unsharpMask(img image.Image, op types.ImageOperation) image.Image {
+	radius := defaultFilterValue(op.Radius)
+	amount := defaultFilterValue(op.Amount)
+
+	src := imaging.Clone(img)
+	blurred := imaging.Blur(src, radius)
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			orig := float64(src.Pix[i+c])
+			diff := orig - float64(blurred.Pix[i+c])
+			if math.Abs(diff) < op.Threshold {
+				continue
+			}
+			src.Pix[i+c] = clampUint8(orig + amount*diff)
+		}
+	}
+
+	return src
+}
+
+// clampUint8 rounds v to the nearest integer in [0, 255]
+func clampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// formatsWithoutAlpha lists the output formats whose encoders drop the alpha
+// channel, which would otherwise turn transparent areas black. GIF keeps
+// binary transparency through a transparent palette entry instead.
+var formatsWithoutAlpha = map[string]bool{
+	types.FormatJPEG: true,
+	types.FormatBMP:  true,
+}
+
+// defaultFlattenColor is the background transparent areas are composited
+// onto when no background color is given
+var defaultFlattenColor = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+
+// hasAlpha reports whether any pixel of the image is not fully opaque
+func hasAlpha(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flattenAlpha composites the image onto an opaque background color. A
+// translucent background is made opaque first so the result has no alpha.
+func flattenAlpha(img image.Image, bg color.NRGBA) *image.NRGBA {
+	bg.A = 255
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
@@ -5,24 +5,43 @@ import (
 	"context"
 	"fmt"
 	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"event-driven-image-pipeline/pkg/icc"
+	"event-driven-image-pipeline/pkg/metadata"
+	"event-driven-image-pipeline/pkg/phash"
 	"event-driven-image-pipeline/pkg/types"
+	"event-driven-image-pipeline/pkg/webp"
 
 	"github.com/disintegration/imaging"
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
+// defaultQuality is the JPEG quality used when an output does not set one
+const defaultQuality = 90
+
+// SimilarFinder looks up previously processed jobs by perceptual hash
+type SimilarFinder interface {
+	FindSimilar(ctx context.Context, hash uint64, maxDistance int) ([]types.SimilarJob, error)
+}
+
 // ImageProcessor handles image processing operations
 type ImageProcessor struct {
 	minioClient *minio.Client
 	bucketName  string
+	similar     SimilarFinder
 }
 
 // NewImageProcessor creates a new image processor instance
@@ -33,29 +52,116 @@ func NewImageProcessor(minioClient *minio.Client, bucketName string) *ImageProce
 	}
 }
 
+// SetSimilarFinder enables the near-duplicate check ProcessJob runs before
+// rendering outputs
+func (p *ImageProcessor) SetSimilarFinder(f SimilarFinder) {
+	p.similar = f
+}
+
 // ProcessJob processes a complete image processing job
 func (p *ImageProcessor) ProcessJob(ctx context.Context, job *types.Job) error {
 	startTime := time.Now()
 
 	// Download the source image
-	img, err := p.downloadImage(ctx, job.ImageURL)
+	src, err := p.downloadImage(ctx, job.ImageURL, job.Options.AutoOrientEnabled())
 	if err != nil {
 		return fmt.Errorf("failed to download image: %w", err)
 	}
 
-	// Process each operation
+	// Hash the source so re-uploads of the same photo can be found, and flag
+	// the ones already processed before paying for the outputs
+	hash := phash.DHash(src.image)
+	job.PerceptualHash = phash.Format(hash)
+	if p.similar != nil {
+		matches, err := p.similar.FindSimilar(ctx, hash, phash.DefaultMaxDistance)
+		if err != nil {
+			log.Printf("Failed to look up duplicates for job %s: %v", job.ID, err)
+		}
+		job.Duplicates = slices.DeleteFunc(matches, func(m types.SimilarJob) bool { return m.JobID == job.ID })
+		if len(job.Duplicates) > 0 {
+			log.Printf("Job %s is a near duplicate of %d processed jobs", job.ID, len(job.Duplicates))
+		}
+	}
+
+	// Compute loading placeholders; they are optional, so failures are only logged
+	if job.Options.Placeholder != "" || job.Options.LQIP {
+		placeholder, err := computePlaceholder(src.image, job.Options)
+		if err != nil {
+			log.Printf("Failed to compute placeholder for job %s: %v", job.ID, err)
+		} else {
+			job.Placeholder = placeholder
+		}
+	}
+
+	// Extract the source colors if requested
+	if job.Options.Analyze {
+		analysis, err := analyzeColors(src.image, job.Options.PaletteSize)
+		if err != nil {
+			log.Printf("Failed to analyze colors for job %s: %v", job.ID, err)
+		} else {
+			job.Analysis = analysis
+		}
+	}
+
+	// Extract the requested source metadata
+	if len(job.Options.Metadata) > 0 {
+		meta, err := extractMetadata(src, job.Options.Metadata)
+		if err != nil {
+			log.Printf("Failed to extract metadata for job %s: %v", job.ID, err)
+		}
+		job.Metadata = meta
+	}
+
+	// Process each output, recording failures on the job so a missing
+	// result can be told apart from one that was never requested
 	var results []types.ProcessedImage
-	for _, op := range job.Operations {
-		result, err := p.processOperation(ctx, img, op, job.ID)
+	var failures []types.OutputError
+	fail := func(output string, err error) {
+		log.Printf("Failed to process %s of job %s: %v", output, job.ID, err)
+		failures = append(failures, types.OutputError{Output: output, Error: err.Error()})
+	}
+	for i, spec := range job.Outputs {
+		result, err := p.processOutput(ctx, src, spec, job.ID)
 		if err != nil {
-			log.Printf("Failed to process operation %s: %v", op.Type, err)
+			fail(fmt.Sprintf("outputs[%d]", i), err)
 			continue
 		}
 		results = append(results, result)
 	}
 
-	// Update job with results
+	// Flat operations are processed as single-step outputs
+	for i, op := range job.Operations {
+		if op.Type == types.OpResponsive {
+			variants, err := p.processResponsive(ctx, src, op, job.ID)
+			if err != nil {
+				fail(fmt.Sprintf("operations[%d]", i), err)
+				continue
+			}
+			results = append(results, variants...)
+			continue
+		}
+
+		result, err := p.processOutput(ctx, src, op.AsOutput(), job.ID)
+		if err != nil {
+			fail(fmt.Sprintf("operations[%d]", i), err)
+			continue
+		}
+
+		// Report the operation the way it was requested
+		op.Format = result.Output.Format
+		op.OutputKey = result.Output.OutputKey
+		result.Operation = op
+		result.Output = nil
+		results = append(results, result)
+	}
+
 	job.Results = results
+	job.Errors = failures
+	if len(results) == 0 && len(failures) > 0 {
+		return fmt.Errorf("all %d outputs failed, the first with: %s", len(failures), failures[0].Error)
+	}
+
+	// Update job with results
 	job.Status = types.StatusCompleted
 	now := time.Now()
 	job.CompletedAt = &now
@@ -66,18 +172,19 @@ func (p *ImageProcessor) ProcessJob(ctx context.Context, job *types.Job) error {
 	return nil
 }
 
-// downloadImage downloads an image from URL or object storage
-func (p *ImageProcessor) downloadImage(ctx context.Context, imageURL string) (image.Image, error) {
+// downloadImage downloads an image from URL or object storage, optionally
+// rotating it upright according to its EXIF orientation tag
+func (p *ImageProcessor) downloadImage(ctx context.Context, imageURL string, autoOrient bool) (*sourceImage, error) {
 	if strings.HasPrefix(imageURL, "http://") || strings.HasPrefix(imageURL, "https://") {
-		return p.downloadFromHTTP(ctx, imageURL)
+		return p.downloadFromHTTP(ctx, imageURL, autoOrient)
 	}
 
 	// Assume it's an object storage key
-	return p.downloadFromStorage(ctx, imageURL)
+	return p.downloadFromStorage(ctx, imageURL, autoOrient)
 }
 
 // downloadFromHTTP downloads an image from HTTP URL
-func (p *ImageProcessor) downloadFromHTTP(ctx context.Context, url string) (image.Image, error) {
+func (p *ImageProcessor) downloadFromHTTP(ctx context.Context, url string, autoOrient bool) (*sourceImage, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -93,142 +200,357 @@ func (p *ImageProcessor) downloadFromHTTP(ctx context.Context, url string) (imag
 		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
 	}
 
-	img, err := imaging.Decode(resp.Body)
+	src, err := decodeImage(resp.Body, autoOrient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	return img, nil
+	return src, nil
 }
 
 // downloadFromStorage downloads an image from object storage
-func (p *ImageProcessor) downloadFromStorage(ctx context.Context, objectKey string) (image.Image, error) {
+func (p *ImageProcessor) downloadFromStorage(ctx context.Context, objectKey string, autoOrient bool) (*sourceImage, error) {
 	obj, err := p.minioClient.GetObject(ctx, p.bucketName, objectKey, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object from storage: %w", err)
 	}
 	defer obj.Close()
 
-	img, err := imaging.Decode(obj)
+	src, err := decodeImage(obj, autoOrient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	return img, nil
+	return src, nil
 }
 
-// processOperation processes a single image operation
-func (p *ImageProcessor) processOperation(ctx context.Context, img image.Image, op types.ImageOperation, jobID string) (types.ProcessedImage, error) {
+// processOutput runs the steps of an output spec in order and uploads the
+// encoded result
+func (p *ImageProcessor) processOutput(ctx context.Context, src *sourceImage, spec types.OutputSpec, jobID string) (types.ProcessedImage, error) {
 	startTime := time.Now()
 
-	// Apply the operation
-	processedImg, err := p.applyOperation(img, op)
+	// Anything other than a supported format is encoded as JPEG, so record
+	// that as the format to keep the extension and content type truthful
+	switch spec.Format {
+	case types.FormatJPEG, types.FormatPNG, types.FormatWebP,
+		types.FormatGIF, types.FormatBMP, types.FormatTIFF:
+	default:
+		spec.Format = types.FormatJPEG
+	}
+
+	// Pick a single frame as a poster image if requested
+	img := src.image
+	if spec.Frame != nil {
+		frame, err := src.frame(*spec.Frame)
+		if err != nil {
+			return types.ProcessedImage{}, err
+		}
+		img = frame
+	}
+
+	// Apply the steps, to every frame when an animation stays animated
+	var result types.ProcessedImage
+	var processedImg image.Image
+	var animation *gif.GIF
+	var err error
+	if spec.Frame == nil && keepsAnimation(src, spec) {
+		animation, err = p.applyToAnimation(ctx, src.animation, spec.Steps, &result)
+		if err == nil {
+			processedImg = animation.Image[0]
+		}
+	} else {
+		processedImg, err = p.applySteps(ctx, img, spec.Steps, &result)
+	}
 	if err != nil {
-		return types.ProcessedImage{}, fmt.Errorf("failed to apply operation: %w", err)
+		return types.ProcessedImage{}, fmt.Errorf("failed to apply steps: %w", err)
+	}
+
+	// Composite transparent areas onto the background for formats that
+	// cannot store alpha
+	if animation == nil && formatsWithoutAlpha[spec.Format] && hasAlpha(processedImg) {
+		bg, err := parseColor(spec.Background, defaultFlattenColor)
+		if err != nil {
+			return types.ProcessedImage{}, fmt.Errorf("failed to flatten image: %w", err)
+		}
+		processedImg = flattenAlpha(processedImg, bg)
+		result.Flattened = true
 	}
 
 	// Generate output key
-	if op.OutputKey == "" {
-		op.OutputKey = fmt.Sprintf("processed/%s/%s_%s", jobID, op.Type, uuid.New().String()[:8])
+	if spec.OutputKey == "" {
+		spec.OutputKey = fmt.Sprintf("processed/%s/%s_%s", jobID, outputName(spec), uuid.New().String()[:8])
 	}
 
-	// Upload result
-	outputURL, err := p.uploadResult(ctx, processedImg, op)
+	// Encode and upload the result
+	var outputURL string
+	var size int64
+	quality := spec.Quality
+	if quality == 0 {
+		quality = defaultQuality
+	}
+	if animation != nil {
+		outputURL, size, err = p.uploadAnimation(ctx, animation, spec)
+	} else {
+		policy := spec.Metadata
+		if policy == "" {
+			policy = types.MetadataStrip
+		}
+		raw := metadata.Read(src.data, src.format).Filter(policy, src.autoOriented)
+		if spec.EmbedICC {
+			raw.ICC = icc.SRGB()
+		}
+
+		var encoded []byte
+		if spec.AutoQuality && spec.Format == types.FormatJPEG {
+			quality, result.SSIM, err = chooseAutoQuality(processedImg, spec)
+		}
+		switch {
+		case err != nil:
+		case spec.MaxBytes > 0:
+			chosen, chosenBounds := quality, processedImg.Bounds()
+			encoded, processedImg, quality, err = encodeWithinBudget(processedImg, spec, quality, raw)
+			if err != nil {
+				err = fmt.Errorf("failed to meet the max_bytes budget: %w", err)
+				break
+			}
+			// The score no longer applies once the budget overrides the choice
+			if quality != chosen || processedImg.Bounds() != chosenBounds {
+				result.SSIM = 0
+			}
+		default:
+			encoded, err = encodeImage(processedImg, spec.Format, quality, raw)
+		}
+		if err == nil {
+			outputURL, size, err = p.uploadEncoded(ctx, bytes.NewBuffer(encoded), spec)
+		}
+	}
 	if err != nil {
-		return types.ProcessedImage{}, fmt.Errorf("failed to upload result: %w", err)
+		return types.ProcessedImage{}, fmt.Errorf("failed to encode and upload result: %w", err)
 	}
 
 	// Get image dimensions
 	bounds := processedImg.Bounds()
 
-	result := types.ProcessedImage{
-		Operation:      op,
-		OutputURL:      outputURL,
-		OutputKey:      op.OutputKey,
-		Width:          bounds.Dx(),
-		Height:         bounds.Dy(),
-		Format:         op.Format,
-		ProcessingTime: time.Since(startTime),
+	result.Output = &spec
+	result.OutputURL = outputURL
+	result.OutputKey = spec.OutputKey
+	result.Size = size
+	result.Width = bounds.Dx()
+	result.Height = bounds.Dy()
+	result.Format = spec.Format
+	result.ProcessingTime = time.Since(startTime)
+	if spec.Format == types.FormatJPEG {
+		result.Quality = quality
 	}
 
 	return result, nil
 }
 
-// applyOperation applies a single operation to an image
-func (p *ImageProcessor) applyOperation(img image.Image, op types.ImageOperation) (image.Image, error) {
+// outputName names an output after its step types, e.g. "resize-sharpen"
+func outputName(spec types.OutputSpec) string {
+	if len(spec.Steps) == 0 {
+		return types.OpFormat
+	}
+	names := make([]string, len(spec.Steps))
+	for i, step := range spec.Steps {
+		names[i] = step.Type
+	}
+	return strings.Join(names, "-")
+}
+
+// applySteps applies the operations to the image in order
+func (p *ImageProcessor) applySteps(ctx context.Context, img image.Image, steps []types.ImageOperation, info *types.ProcessedImage) (image.Image, error) {
+	for i, step := range steps {
+		processed, err := p.applyOperation(ctx, img, step, info)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i, step.Type, err)
+		}
+		img = processed
+	}
+	return img, nil
+}
+
+// applyOperation applies a single operation to an image, recording any
+// operation details (such as the crop rectangle) in info
+func (p *ImageProcessor) applyOperation(ctx context.Context, img image.Image, op types.ImageOperation, info *types.ProcessedImage) (image.Image, error) {
 	var result image.Image = img
 
 	// Apply resize if specified
 	if op.Type == types.OpResize && (op.Width > 0 || op.Height > 0) {
-		if op.Width > 0 && op.Height > 0 {
-			result = imaging.Resize(result, op.Width, op.Height, imaging.Lanczos)
-		} else if op.Width > 0 {
-			result = imaging.Resize(result, op.Width, 0, imaging.Lanczos)
-		} else {
-			result = imaging.Resize(result, 0, op.Height, imaging.Lanczos)
+		resized, rect, err := resizeImage(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resize image: %w", err)
 		}
+		if !rect.Empty() {
+			info.CropRect = &types.Rect{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+		}
+		result = resized
 	}
 
 	// Apply watermark if specified
-	if op.Type == types.OpWatermark && op.Watermark != "" {
-		// Simple text watermark for now
-		result = p.addWatermark(result, op.Watermark)
+	if op.Type == types.OpWatermark {
+		watermarked, err := p.addWatermark(ctx, result, op)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add watermark: %w", err)
+		}
+		result = watermarked
 	}
 
-	return result, nil
-}
+	// Apply crop if specified
+	if op.Type == types.OpCrop {
+		cropped, rect, err := cropImage(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("failed to crop image: %w", err)
+		}
+		info.CropRect = &types.Rect{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+		result = cropped
+	}
+
+	// Apply trim if specified
+	if op.Type == types.OpTrim {
+		trimmed, rect := trimImage(result, op)
+		info.TrimRect = &types.Rect{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+		result = trimmed
+	}
+
+	// Apply mask if specified
+	if op.Type == types.OpMask {
+		masked, err := maskImage(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mask image: %w", err)
+		}
+		result = masked
+	}
+
+	// Apply border if specified
+	if op.Type == types.OpBorder {
+		bordered, err := addBorder(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add border: %w", err)
+		}
+		result = bordered
+	}
+
+	// Apply rotation if specified
+	if op.Type == types.OpRotate {
+		bg, err := parseColor(op.Background, color.NRGBA{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to rotate image: %w", err)
+		}
+		result = imaging.Rotate(result, op.Angle, bg)
+	}
+
+	// Apply flip if specified
+	if op.Type == types.OpFlip {
+		switch op.Direction {
+		case types.FlipHorizontal:
+			result = imaging.FlipH(result)
+		case types.FlipVertical:
+			result = imaging.FlipV(result)
+		default:
+			return nil, fmt.Errorf("unknown flip direction %q", op.Direction)
+		}
+	}
+
+	// Apply filters if specified
+	switch op.Type {
+	case types.OpBlur:
+		result = blurImage(result, op)
+	case types.OpSharpen:
+		result = sharpenImage(result, op)
+	case types.OpUnsharp:
+		result = unsharpMask(result, op)
+	}
 
-// addWatermark adds a simple text watermark to the image
-func (p *ImageProcessor) addWatermark(img image.Image, text string) image.Image {
-	// For now, we'll just return the original image
-	// TODO: Implement actual watermarking
-	log.Printf("Watermarking not yet implemented, returning original image")
-	return img
+	// Apply tonal and color adjustments if specified
+	if op.Type == types.OpAdjust {
+		result = adjustImage(result, op)
+	}
+
+	// Apply stylistic effect if specified
+	if op.Type == types.OpEffect {
+		affected, err := applyEffect(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply effect: %w", err)
+		}
+		result = affected
+	}
+
+	return result, nil
 }
 
-// uploadResult uploads the processed image to object storage
-func (p *ImageProcessor) uploadResult(ctx context.Context, img image.Image, op types.ImageOperation) (string, error) {
-	// Encode image to bytes
+// encodeImage encodes the processed image in the given format with the
+// metadata blocks the format can carry. Quality only applies to JPEG.
+func encodeImage(img image.Image, format string, quality int, raw metadata.Raw) ([]byte, error) {
 	var buf bytes.Buffer
 	var err error
 
-	switch op.Format {
+	switch format {
 	case types.FormatJPEG:
-		quality := op.Quality
-		if quality == 0 {
-			quality = 90
-		}
 		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
 	case types.FormatPNG:
 		err = png.Encode(&buf, img)
 	case types.FormatWebP:
-		// WebP encoding not yet implemented, fallback to JPEG
-		log.Printf("WebP not yet implemented, falling back to JPEG")
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+		// Lossless only, so Quality does not apply
+		err = webp.Encode(&buf, img, &webp.Options{EXIF: raw.EXIF, XMP: raw.XMP, ICC: raw.ICC})
+	case types.FormatGIF:
+		if hasAlpha(img) {
+			// The default Plan9 palette has no transparent entry, so one
+			// is added in place of its last color
+			err = gif.Encode(&buf, quantizeFrame(img, palette.Plan9[:255]), nil)
+		} else {
+			err = gif.Encode(&buf, img, &gif.Options{NumColors: 256})
+		}
+	case types.FormatBMP:
+		err = bmp.Encode(&buf, img)
+	case types.FormatTIFF:
+		err = tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
 	default:
 		// Default to JPEG
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: defaultQuality})
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("failed to encode image: %w", err)
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	// The standard library encoders write no metadata, so it is spliced in
+	// afterwards
+	switch format {
+	case types.FormatJPEG:
+		return metadata.EmbedJPEG(buf.Bytes(), raw), nil
+	case types.FormatPNG:
+		return metadata.EmbedPNG(buf.Bytes(), raw), nil
 	}
+	return buf.Bytes(), nil
+}
 
+// uploadEncoded uploads already encoded image bytes under the output key
+// with the extension and content type of its format
+func (p *ImageProcessor) uploadEncoded(ctx context.Context, buf *bytes.Buffer, spec types.OutputSpec) (string, int64, error) {
 	// Add file extension
-	ext := "." + op.Format
+	ext := "." + spec.Format
 	if ext == ".jpeg" {
 		ext = ".jpg"
 	}
-	objectKey := op.OutputKey + ext
+	objectKey := spec.OutputKey + ext
 
-	// Upload to MinIO
-	_, err = p.minioClient.PutObject(ctx, p.bucketName, objectKey, &buf, int64(buf.Len()), minio.PutObjectOptions{
-		ContentType: "image/" + op.Format,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload to storage: %w", err)
+	size := int64(buf.Len())
+	if err := p.putObject(ctx, objectKey, buf, "image/"+spec.Format); err != nil {
+		return "", 0, err
 	}
 
 	// Return the object key (in production, this would be a full URL)
-	return objectKey, nil
+	return objectKey, size, nil
+}
+
+// putObject uploads the buffer to object storage
+func (p *ImageProcessor) putObject(ctx context.Context, objectKey string, buf *bytes.Buffer, contentType string) error {
+	_, err := p.minioClient.PutObject(ctx, p.bucketName, objectKey, buf, int64(buf.Len()), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to storage: %w", err)
+	}
+	return nil
 }
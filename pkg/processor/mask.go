@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// maskSamples is the number of subsamples per axis used to anti-alias the
+// mask edge
+const maskSamples = 4
+
+// maskImage makes everything outside the mask shape transparent. Circles are
+// cut from a square region anchored by op.Gravity (center by default);
+// ellipses and rounded rectangles cover the whole image.
+func maskImage(img image.Image, op types.ImageOperation) (image.Image, error) {
+	dst := imaging.Clone(img)
+	w, h := float64(dst.Bounds().Dx()), float64(dst.Bounds().Dy())
+
+	var inside func(x, y float64) bool
+	switch op.Shape {
+	case types.MaskRounded:
+		if op.Radius <= 0 {
+			return nil, fmt.Errorf("rounded mask requires a positive radius")
+		}
+		r := math.Min(op.Radius, math.Min(w, h)/2)
+		inside = func(x, y float64) bool {
+			// Distance to the inner rectangle the corners are rounded around
+			dx := x - math.Max(r, math.Min(x, w-r))
+			dy := y - math.Max(r, math.Min(y, h-r))
+			return dx*dx+dy*dy <= r*r
+		}
+	case types.MaskCircle:
+		gravity := op.Gravity
+		if gravity == "" {
+			gravity = types.GravityCenter
+		}
+		offsets, ok := gravityOffsets[gravity]
+		if !ok {
+			return nil, fmt.Errorf("unknown mask gravity %q", op.Gravity)
+		}
+		side := min(dst.Bounds().Dx(), dst.Bounds().Dy())
+		x0 := int(float64(dst.Bounds().Dx()-side) * offsets[0])
+		y0 := int(float64(dst.Bounds().Dy()-side) * offsets[1])
+		dst = imaging.Crop(dst, image.Rect(x0, y0, x0+side, y0+side))
+		w, h = float64(side), float64(side)
+		inside = ellipseContains(w, h)
+	case types.MaskEllipse:
+		inside = ellipseContains(w, h)
+	default:
+		return nil, fmt.Errorf("unknown mask shape %q", op.Shape)
+	}
+
+	applyMask(dst, inside)
+	return dst, nil
+}
+
+// ellipseContains returns a test for points inside the ellipse inscribed in
+// a w x h rectangle
+func ellipseContains(w, h float64) func(x, y float64) bool {
+	rx, ry := w/2, h/2
+	return func(x, y float64) bool {
+		dx, dy := (x-rx)/rx, (y-ry)/ry
+		return dx*dx+dy*dy <= 1
+	}
+}
+
+// applyMask scales each pixel's alpha by how much of it lies inside the
+// shape. The shapes are convex, so a pixel whose four corners are all inside
+// is fully covered and only edge pixels need to be subsampled.
+func applyMask(img *image.NRGBA, inside func(x, y float64) bool) {
+	bounds := img.Bounds()
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			fx, fy := float64(x), float64(y)
+			corners := 0
+			for _, c := range [4][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				if inside(fx+c[0], fy+c[1]) {
+					corners++
+				}
+			}
+			if corners == 4 {
+				continue
+			}
+
+			covered := 0
+			if corners > 0 {
+				for sy := 0; sy < maskSamples; sy++ {
+					for sx := 0; sx < maskSamples; sx++ {
+						if inside(fx+(float64(sx)+0.5)/maskSamples, fy+(float64(sy)+0.5)/maskSamples) {
+							covered++
+						}
+					}
+				}
+			}
+
+			i := y*img.Stride + x*4 + 3
+			img.Pix[i] = uint8(int(img.Pix[i]) * covered / (maskSamples * maskSamples))
+		}
+	}
+}
+
+// addBorder surrounds the image with a solid border of op.BorderWidth pixels
+// in op.Color (black by default), enlarging the canvas
+func addBorder(img image.Image, op types.ImageOperation) (image.Image, error) {
+	if op.BorderWidth <= 0 {
+		return nil, fmt.Errorf("border requires a positive width, got %d", op.BorderWidth)
+	}
+	borderColor, err := parseColor(op.Color, color.NRGBA{A: 255})
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	b := op.BorderWidth
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx()+2*b, bounds.Dy()+2*b))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(borderColor), image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(b, b, b+bounds.Dx(), b+bounds.Dy()), img, bounds.Min, draw.Src)
+	return dst, nil
+}
@@ -0,0 +1,197 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// columnImage is an opaque image whose red channel encodes the column, so
+// the region a mask kept can be told from its pixels
+func columnImage(w, h int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 6), G: 100, B: 50, A: alpha})
+		}
+	}
+	return img
+}
+
+// alphaWant is the expected alpha of one pixel; partial means strictly
+// between transparent and the source alpha
+type alphaWant struct {
+	x, y    int
+	alpha   uint8
+	partial bool
+}
+
+func TestMaskImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     types.ImageOperation
+		src    *image.NRGBA
+		size   image.Point
+		red    uint8 // red channel at the center, identifying the kept columns
+		pixels []alphaWant
+	}{
+		{
+			name: "rounded",
+			op:   types.ImageOperation{Shape: types.MaskRounded, Radius: 10},
+			src:  columnImage(40, 30, 255),
+			size: image.Pt(40, 30),
+			red:  120,
+			pixels: []alphaWant{
+				{x: 0, y: 0, alpha: 0},
+				{x: 39, y: 0, alpha: 0},
+				{x: 0, y: 29, alpha: 0},
+				{x: 39, y: 29, alpha: 0},
+				{x: 2, y: 2, alpha: 0},
+				{x: 3, y: 3, alpha: 255},
+				{x: 0, y: 6, partial: true},
+				{x: 6, y: 0, partial: true},
+				{x: 10, y: 0, alpha: 255},
+				{x: 0, y: 15, alpha: 255},
+				{x: 20, y: 15, alpha: 255},
+			},
+		},
+		{
+			name: "rounded radius clamped to a pill",
+			op:   types.ImageOperation{Shape: types.MaskRounded, Radius: 100},
+			src:  columnImage(40, 20, 255),
+			size: image.Pt(40, 20),
+			red:  120,
+			pixels: []alphaWant{
+				{x: 0, y: 0, alpha: 0},
+				{x: 20, y: 0, alpha: 255},
+				{x: 0, y: 7, partial: true},
+				{x: 20, y: 10, alpha: 255},
+			},
+		},
+		{
+			name: "circle",
+			op:   types.ImageOperation{Shape: types.MaskCircle},
+			src:  columnImage(40, 20, 255),
+			size: image.Pt(20, 20),
+			red:  120,
+			pixels: []alphaWant{
+				{x: 0, y: 0, alpha: 0},
+				{x: 19, y: 0, alpha: 0},
+				{x: 0, y: 19, alpha: 0},
+				{x: 19, y: 19, alpha: 0},
+				{x: 2, y: 2, alpha: 0},
+				{x: 3, y: 3, alpha: 255},
+				{x: 0, y: 7, partial: true},
+				{x: 10, y: 10, alpha: 255},
+			},
+		},
+		{
+			name: "circle west",
+			op:   types.ImageOperation{Shape: types.MaskCircle, Gravity: types.GravityWest},
+			src:  columnImage(40, 20, 255),
+			size: image.Pt(20, 20),
+			red:  60,
+			pixels: []alphaWant{
+				{x: 0, y: 0, alpha: 0},
+				{x: 10, y: 10, alpha: 255},
+			},
+		},
+		{
+			name: "circle east",
+			op:   types.ImageOperation{Shape: types.MaskCircle, Gravity: types.GravityEast},
+			src:  columnImage(40, 20, 255),
+			size: image.Pt(20, 20),
+			red:  180,
+		},
+		{
+			name: "ellipse",
+			op:   types.ImageOperation{Shape: types.MaskEllipse},
+			src:  columnImage(40, 20, 255),
+			size: image.Pt(40, 20),
+			red:  120,
+			pixels: []alphaWant{
+				{x: 0, y: 0, alpha: 0},
+				{x: 39, y: 19, alpha: 0},
+				{x: 12, y: 0, partial: true},
+				{x: 0, y: 7, partial: true},
+				{x: 20, y: 0, alpha: 255},
+				{x: 20, y: 10, alpha: 255},
+				{x: 2, y: 10, alpha: 255},
+			},
+		},
+		{
+			name: "translucent source",
+			op:   types.ImageOperation{Shape: types.MaskEllipse},
+			src:  columnImage(40, 20, 128),
+			size: image.Pt(40, 20),
+			red:  120,
+			pixels: []alphaWant{
+				{x: 0, y: 0, alpha: 0},
+				{x: 12, y: 0, partial: true},
+				{x: 20, y: 10, alpha: 128},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := maskImage(tt.src, tt.op)
+			if err != nil {
+				t.Fatalf("maskImage: %v", err)
+			}
+			got := imaging.Clone(out)
+			if size := got.Bounds().Size(); size != tt.size {
+				t.Fatalf("size is %v, want %v", size, tt.size)
+			}
+			if c := got.NRGBAAt(tt.size.X/2, tt.size.Y/2); c.R != tt.red {
+				t.Errorf("center red is %d, want %d", c.R, tt.red)
+			}
+			sourceAlpha := tt.src.NRGBAAt(0, 0).A
+			for _, p := range tt.pixels {
+				a := got.NRGBAAt(p.x, p.y).A
+				switch {
+				case p.partial && (a == 0 || a >= sourceAlpha):
+					t.Errorf("alpha at (%d,%d) is %d, want between 0 and %d", p.x, p.y, a, sourceAlpha)
+				case !p.partial && a != p.alpha:
+					t.Errorf("alpha at (%d,%d) is %d, want %d", p.x, p.y, a, p.alpha)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskImageErrors(t *testing.T) {
+	img := columnImage(4, 4, 255)
+	for _, op := range []types.ImageOperation{
+		{Shape: "star"},
+		{Shape: types.MaskRounded},
+		{Shape: types.MaskCircle, Gravity: "smart"},
+	} {
+		if _, err := maskImage(img, op); err == nil {
+			t.Errorf("maskImage(%+v) succeeded, want an error", op)
+		}
+	}
+}
+
+func TestAddBorder(t *testing.T) {
+	out, err := addBorder(columnImage(10, 6, 255), types.ImageOperation{BorderWidth: 3, Color: "#ff0000"})
+	if err != nil {
+		t.Fatalf("addBorder: %v", err)
+	}
+	got := imaging.Clone(out)
+	if size := got.Bounds().Size(); size != image.Pt(16, 12) {
+		t.Fatalf("size is %v, want 16x12", size)
+	}
+	for _, p := range []image.Point{{0, 0}, {2, 5}, {15, 11}, {8, 10}} {
+		if c := got.NRGBAAt(p.X, p.Y); c != (color.NRGBA{R: 255, A: 255}) {
+			t.Errorf("border pixel %v is %v, want red", p, c)
+		}
+	}
+	if c := got.NRGBAAt(3, 3); c != (color.NRGBA{R: 0, G: 100, B: 50, A: 255}) {
+		t.Errorf("first image pixel is %v", c)
+	}
+}
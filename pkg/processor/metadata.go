@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"event-driven-image-pipeline/pkg/metadata"
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// extractMetadata parses the requested metadata groups from the original
+// source bytes. It returns nil when none of them are present, and any parse
+// errors alongside whatever could still be read.
+func extractMetadata(src *sourceImage, groups []string) (*types.ImageMetadata, error) {
+	want := func(group string) bool {
+		return slices.Contains(groups, group) || slices.Contains(groups, types.MetadataAll)
+	}
+
+	raw := metadata.Read(src.data, src.format)
+	var result types.ImageMetadata
+	var errs []error
+
+	if raw.EXIF != nil && (want(types.MetadataEXIF) || want(types.MetadataGPS)) {
+		exif, gps, err := metadata.ParseEXIF(raw.EXIF)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse EXIF: %w", err))
+		}
+		if want(types.MetadataEXIF) {
+			result.EXIF = exif
+		}
+		if want(types.MetadataGPS) {
+			result.GPS = gps
+		}
+	}
+
+	if raw.IPTC != nil && want(types.MetadataIPTC) {
+		result.IPTC = metadata.ParseIPTC(raw.IPTC)
+	}
+
+	if raw.XMP != nil && want(types.MetadataXMP) {
+		xmp, err := metadata.ParseXMP(raw.XMP)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse XMP: %w", err))
+		}
+		if len(xmp) > 0 {
+			result.XMP = xmp
+		}
+	}
+
+	if result.EXIF == nil && result.GPS == nil && result.IPTC == nil && result.XMP == nil {
+		return nil, errors.Join(errs...)
+	}
+	return &result, errors.Join(errs...)
+}
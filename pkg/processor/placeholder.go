@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+
+	"event-driven-image-pipeline/pkg/placeholder"
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// lqipSize is the longest side of the image embedded in the LQIP data URI
+const lqipSize = 16
+
+// computePlaceholder computes the placeholders requested in the job options
+func computePlaceholder(img image.Image, opts types.JobOptions) (*types.Placeholder, error) {
+	var result types.Placeholder
+
+	switch opts.Placeholder {
+	case types.PlaceholderBlurHash:
+		// More components along the longer side keep the layout recognizable
+		x, y := 4, 3
+		if img.Bounds().Dy() > img.Bounds().Dx() {
+			x, y = 3, 4
+		}
+		hash, err := placeholder.BlurHash(img, x, y)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute blurhash: %w", err)
+		}
+		result.BlurHash = hash
+	case types.PlaceholderThumbHash:
+		hash, err := placeholder.ThumbHash(img)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute thumbhash: %w", err)
+		}
+		result.ThumbHash = base64.StdEncoding.EncodeToString(hash)
+	}
+
+	if opts.LQIP {
+		uri, err := placeholder.DataURI(img, lqipSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute LQIP: %w", err)
+		}
+		result.LQIP = uri
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// resizeImage scales the image to the operation's dimensions. With a single
+// dimension the aspect ratio is kept; with both, the fit mode decides how the
+// image is mapped onto the width x height box:
+//
+//   - fill: exactly width x height, stretching the image
+//   - contain: at most width x height, one side matching the box
+//   - cover: exactly width x height, cropping the overflow at the gravity
+//   - pad: exactly width x height, the contained image placed at the gravity
+//     on a background-colored canvas
+//
+// For cover it also returns the region of the source that was kept; for the
+// other modes the rectangle is empty.
+func resizeImage(img image.Image, op types.ImageOperation) (image.Image, image.Rectangle, error) {
+	bounds := img.Bounds()
+	srcW, srcH := float64(bounds.Dx()), float64(bounds.Dy())
+	if srcW == 0 || srcH == 0 {
+		return nil, image.Rectangle{}, fmt.Errorf("cannot resize an empty image")
+	}
+
+	if op.Width <= 0 || op.Height <= 0 {
+		// The free side follows the aspect ratio, which a thin source can
+		// stretch far past the size limit
+		width, height := op.Width, op.Height
+		if width > 0 {
+			height = int(math.Round(srcH * float64(width) / srcW))
+		} else {
+			width = int(math.Round(srcW * float64(height) / srcH))
+		}
+		if width > types.MaxDimension || height > types.MaxDimension {
+			return nil, image.Rectangle{}, fmt.Errorf("resized image would be %dx%d, at most %d pixels per side are allowed",
+				width, height, types.MaxDimension)
+		}
+		return imaging.Resize(img, max(op.Width, 0), max(op.Height, 0), imaging.Lanczos), image.Rectangle{}, nil
+	}
+
+	scaleX := float64(op.Width) / srcW
+	scaleY := float64(op.Height) / srcH
+
+	switch op.Fit {
+	case types.FitFill, "":
+		return imaging.Resize(img, op.Width, op.Height, imaging.Lanczos), image.Rectangle{}, nil
+
+	case types.FitContain:
+		return scaleImage(img, math.Min(scaleX, scaleY)), image.Rectangle{}, nil
+
+	case types.FitCover:
+		// Choose the kept region in source coordinates and scale only that,
+		// so a thin source never builds a huge intermediate image
+		cropW, cropH := coverSize(bounds.Dx(), bounds.Dy(), op.Width, op.Height)
+		var rect image.Rectangle
+		if op.Gravity == types.GravitySmart {
+			rect = smartCropWindow(img, cropW, cropH)
+		} else {
+			offsets, err := fitGravity(op.Gravity)
+			if err != nil {
+				return nil, image.Rectangle{}, err
+			}
+			x := int(float64(bounds.Dx()-cropW) * offsets[0])
+			y := int(float64(bounds.Dy()-cropH) * offsets[1])
+			rect = image.Rect(x, y, x+cropW, y+cropH)
+		}
+		cropped := imaging.Crop(img, rect.Add(bounds.Min))
+		return imaging.Resize(cropped, op.Width, op.Height, imaging.Lanczos), rect, nil
+
+	case types.FitPad:
+		offsets, err := fitGravity(op.Gravity)
+		if err != nil {
+			return nil, image.Rectangle{}, err
+		}
+		bg, err := parseColor(op.Background, color.NRGBA{})
+		if err != nil {
+			return nil, image.Rectangle{}, err
+		}
+		scaled := scaleImage(img, math.Min(scaleX, scaleY))
+		size := scaled.Bounds().Size()
+		x := int(float64(op.Width-size.X) * offsets[0])
+		y := int(float64(op.Height-size.Y) * offsets[1])
+		return imaging.Paste(imaging.New(op.Width, op.Height, bg), scaled, image.Pt(x, y)), image.Rectangle{}, nil
+
+	default:
+		return nil, image.Rectangle{}, fmt.Errorf("unknown fit mode %q", op.Fit)
+	}
+}
+
+// scaleImage resizes the image by a uniform factor, keeping both sides at
+// least one pixel
+func scaleImage(img image.Image, scale float64) *image.NRGBA {
+	bounds := img.Bounds()
+	width := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+	height := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+	return imaging.Resize(img, width, height, imaging.Lanczos)
+}
+
+// coverSize returns the largest size with the width:height aspect ratio that
+// fits in a srcW x srcH image
+func coverSize(srcW, srcH, width, height int) (int, int) {
+	aspect := float64(width) / float64(height)
+	cropW, cropH := srcW, int(math.Round(float64(srcW)/aspect))
+	if cropH > srcH {
+		cropW, cropH = int(math.Round(float64(srcH)*aspect)), srcH
+	}
+	return clampInt(cropW, 1, srcW), clampInt(cropH, 1, srcH)
+}
+
+// fitGravity returns the placement offsets for cover and pad, defaulting to center
+func fitGravity(gravity string) ([2]float64, error) {
+	if gravity == "" {
+		gravity = types.GravityCenter
+	}
+	offsets, ok := gravityOffsets[gravity]
+	if !ok {
+		return [2]float64{}, fmt.Errorf("unknown gravity %q", gravity)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+
+	// opaque lists pixels that must come from the image and transparent
+	// those that must be pad background
+	tests := []struct {
+		name        string
+		op          types.ImageOperation
+		wantSize    image.Point
+		wantRect    image.Rectangle
+		opaque      []image.Point
+		transparent []image.Point
+	}{
+		{
+			name:     "width only",
+			op:       types.ImageOperation{Width: 100},
+			wantSize: image.Pt(100, 50),
+		},
+		{
+			name:     "height only",
+			op:       types.ImageOperation{Height: 100},
+			wantSize: image.Pt(200, 100),
+		},
+		{
+			name:     "fill stretches",
+			op:       types.ImageOperation{Width: 100, Height: 100, Fit: types.FitFill},
+			wantSize: image.Pt(100, 100),
+		},
+		{
+			name:     "default is fill",
+			op:       types.ImageOperation{Width: 50, Height: 80},
+			wantSize: image.Pt(50, 80),
+		},
+		{
+			name:     "contain keeps the aspect ratio",
+			op:       types.ImageOperation{Width: 100, Height: 100, Fit: types.FitContain},
+			wantSize: image.Pt(100, 50),
+		},
+		{
+			name:     "contain limited by height",
+			op:       types.ImageOperation{Width: 1000, Height: 50, Fit: types.FitContain},
+			wantSize: image.Pt(100, 50),
+		},
+		{
+			name:     "cover center",
+			op:       types.ImageOperation{Width: 100, Height: 100, Fit: types.FitCover},
+			wantSize: image.Pt(100, 100),
+			wantRect: image.Rect(100, 0, 300, 200),
+		},
+		{
+			name:     "cover east",
+			op:       types.ImageOperation{Width: 100, Height: 100, Fit: types.FitCover, Gravity: types.GravityEast},
+			wantSize: image.Pt(100, 100),
+			wantRect: image.Rect(200, 0, 400, 200),
+		},
+		{
+			name:     "cover west",
+			op:       types.ImageOperation{Width: 100, Height: 100, Fit: types.FitCover, Gravity: types.GravityWest},
+			wantSize: image.Pt(100, 100),
+			wantRect: image.Rect(0, 0, 200, 200),
+		},
+		{
+			name:     "cover wider than the source",
+			op:       types.ImageOperation{Width: 400, Height: 100, Fit: types.FitCover, Gravity: types.GravitySouth},
+			wantSize: image.Pt(400, 100),
+			wantRect: image.Rect(0, 100, 400, 200),
+		},
+		{
+			name:        "pad center",
+			op:          types.ImageOperation{Width: 100, Height: 100, Fit: types.FitPad},
+			wantSize:    image.Pt(100, 100),
+			opaque:      []image.Point{{50, 50}},
+			transparent: []image.Point{{50, 10}, {50, 90}},
+		},
+		{
+			name:        "pad north",
+			op:          types.ImageOperation{Width: 100, Height: 100, Fit: types.FitPad, Gravity: types.GravityNorth},
+			wantSize:    image.Pt(100, 100),
+			opaque:      []image.Point{{50, 10}},
+			transparent: []image.Point{{50, 90}},
+		},
+		{
+			name:        "pad south",
+			op:          types.ImageOperation{Width: 100, Height: 100, Fit: types.FitPad, Gravity: types.GravitySouth},
+			wantSize:    image.Pt(100, 100),
+			opaque:      []image.Point{{50, 90}},
+			transparent: []image.Point{{50, 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.op.Type = types.OpResize
+			out, rect, err := resizeImage(src, tt.op)
+			if err != nil {
+				t.Fatalf("resizeImage: %v", err)
+			}
+			if size := out.Bounds().Size(); size != tt.wantSize {
+				t.Errorf("size is %v, want %v", size, tt.wantSize)
+			}
+			if rect != tt.wantRect {
+				t.Errorf("crop rect is %v, want %v", rect, tt.wantRect)
+			}
+
+			nrgba := imaging.Clone(out)
+			for _, p := range tt.opaque {
+				if a := nrgba.NRGBAAt(p.X, p.Y).A; a != 255 {
+					t.Errorf("alpha at %v is %d, want 255", p, a)
+				}
+			}
+			for _, p := range tt.transparent {
+				if c := nrgba.NRGBAAt(p.X, p.Y); c != (color.NRGBA{}) {
+					t.Errorf("pixel at %v is %v, want the transparent background", p, c)
+				}
+			}
+		})
+	}
+}
+
+func TestResizeImageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  image.Image
+		op   types.ImageOperation
+		want string
+	}{
+		{"empty image", image.NewNRGBA(image.Rect(0, 0, 0, 0)), types.ImageOperation{Width: 10}, "empty image"},
+		{"free side over the limit", image.NewNRGBA(image.Rect(0, 0, 2, 2000)), types.ImageOperation{Width: 100}, "at most"},
+		{"unknown fit", image.NewNRGBA(image.Rect(0, 0, 10, 10)), types.ImageOperation{Width: 5, Height: 5, Fit: "stretch"}, "unknown fit mode"},
+		{"unknown gravity", image.NewNRGBA(image.Rect(0, 0, 10, 10)), types.ImageOperation{Width: 5, Height: 2, Fit: types.FitCover, Gravity: "up"}, "unknown gravity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := resizeImage(tt.src, tt.op); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error is %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
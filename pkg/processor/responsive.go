@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/google/uuid"
+)
+
+// processResponsive renders the source at each responsive width in each
+// requested format and uploads a JSON manifest describing the variants. The
+// manifest is returned as the last result.
+func (p *ImageProcessor) processResponsive(ctx context.Context, src *sourceImage, op types.ImageOperation, jobID string) ([]types.ProcessedImage, error) {
+	startTime := time.Now()
+
+	formats := op.Formats
+	if len(formats) == 0 {
+		formats = []string{op.Format}
+	}
+
+	baseKey := op.OutputKey
+	if baseKey == "" {
+		baseKey = fmt.Sprintf("processed/%s/%s_%s", jobID, op.Type, uuid.New().String()[:8])
+	}
+
+	// Never upscale; a source narrower than every width gets one variant at
+	// its own width
+	srcWidth := src.image.Bounds().Dx()
+	var widths []int
+	for _, w := range op.ResponsiveWidths() {
+		if w <= srcWidth {
+			widths = append(widths, w)
+		}
+	}
+	if len(widths) == 0 {
+		widths = []int{srcWidth}
+	}
+
+	var results []types.ProcessedImage
+	var manifest types.ResponsiveManifest
+	for _, format := range formats {
+		for _, width := range widths {
+			spec := op.AsOutput()
+			spec.Steps = []types.ImageOperation{{Type: types.OpResize, Width: width}}
+			spec.Format = format
+			spec.OutputKey = fmt.Sprintf("%s_%dw", baseKey, width)
+			result, err := p.processOutput(ctx, src, spec, jobID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render %dw %s variant: %w", width, format, err)
+			}
+
+			result.Operation = op
+			result.Output = nil
+			results = append(results, result)
+
+			manifest.Variants = append(manifest.Variants, types.ResponsiveVariant{
+				Width:  result.Width,
+				Height: result.Height,
+				Format: result.Format,
+				Size:   result.Size,
+				Key:    result.OutputURL,
+			})
+		}
+	}
+
+	// Upload the manifest
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestKey := baseKey + "_manifest.json"
+	if err := p.putObject(ctx, manifestKey, bytes.NewBuffer(data), "application/json"); err != nil {
+		return nil, fmt.Errorf("failed to upload manifest: %w", err)
+	}
+
+	results = append(results, types.ProcessedImage{
+		Operation:      op,
+		OutputURL:      manifestKey,
+		OutputKey:      manifestKey,
+		Size:           int64(len(data)),
+		Format:         types.FormatJSON,
+		ProcessingTime: time.Since(startTime),
+		Manifest:       &manifest,
+	})
+
+	return results, nil
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// smartCropAnalysisSize is the longest side of the downscaled copy used to
+// score crop candidates
+const smartCropAnalysisSize = 256
+
+// smartCropWindow returns the width x height window of the image with the
+// highest edge density, relative to the source. The window must fit in the
+// image.
+func smartCropWindow(img image.Image, width, height int) image.Rectangle {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// Score candidate windows on a small copy of the image
+	scale := math.Min(1, smartCropAnalysisSize/float64(max(srcW, srcH)))
+	small := imaging.Grayscale(imaging.Resize(img,
+		max(1, int(math.Round(float64(srcW)*scale))),
+		max(1, int(math.Round(float64(srcH)*scale))),
+		imaging.Box))
+	sw, sh := small.Bounds().Dx(), small.Bounds().Dy()
+	winW := clampInt(int(math.Round(float64(width)*scale)), 1, sw)
+	winH := clampInt(int(math.Round(float64(height)*scale)), 1, sh)
+
+	integral := edgeEnergyIntegral(small)
+	stride := sw + 1
+	windowSum := func(x, y int) float64 {
+		return integral[(y+winH)*stride+x+winW] - integral[y*stride+x+winW] -
+			integral[(y+winH)*stride+x] + integral[y*stride+x]
+	}
+
+	// Ties go to the window closest to the center so flat images crop evenly
+	centerX, centerY := float64(sw-winW)/2, float64(sh-winH)/2
+	bestX, bestY := 0, 0
+	bestScore, bestDist := -1.0, math.MaxFloat64
+	for y := 0; y <= sh-winH; y++ {
+		for x := 0; x <= sw-winW; x++ {
+			score := windowSum(x, y)
+			dist := math.Hypot(float64(x)-centerX, float64(y)-centerY)
+			if score > bestScore+1e-9 || (math.Abs(score-bestScore) <= 1e-9 && dist < bestDist) {
+				bestX, bestY, bestScore, bestDist = x, y, score, dist
+			}
+		}
+	}
+
+	// Map the winning window back to source coordinates
+	x0 := clampInt(int(math.Round(float64(bestX)/scale)), 0, srcW-width)
+	y0 := clampInt(int(math.Round(float64(bestY)/scale)), 0, srcH-height)
+	return image.Rect(x0, y0, x0+width, y0+height)
+}
+
+// edgeEnergyIntegral computes the Sobel gradient magnitude of a grayscale
+// image and returns its summed-area table, (w+1)*(h+1) values in row order
+func edgeEnergyIntegral(gray *image.NRGBA) []float64 {
+	w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+	luma := func(x, y int) float64 {
+		x = clampInt(x, 0, w-1)
+		y = clampInt(y, 0, h-1)
+		return float64(gray.Pix[y*gray.Stride+x*4])
+	}
+
+	stride := w + 1
+	integral := make([]float64, stride*(h+1))
+	for y := 0; y < h; y++ {
+		rowSum := 0.0
+		for x := 0; x < w; x++ {
+			gx := luma(x+1, y-1) + 2*luma(x+1, y) + luma(x+1, y+1) -
+				luma(x-1, y-1) - 2*luma(x-1, y) - luma(x-1, y+1)
+			gy := luma(x-1, y+1) + 2*luma(x, y+1) + luma(x+1, y+1) -
+				luma(x-1, y-1) - 2*luma(x, y-1) - luma(x+1, y-1)
+			rowSum += math.Abs(gx) + math.Abs(gy)
+			integral[(y+1)*stride+x+1] = integral[y*stride+x+1] + rowSum
+		}
+	}
+
+	return integral
+}
+
+// clampInt limits v to the range [lo, hi]
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
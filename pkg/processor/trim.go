@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+// trimImage removes borders that match the color of the top-left pixel, or
+// are transparent when that pixel is transparent. Pixels whose channels all
+// differ from the border color by at most op.Tolerance count as border. It
+// returns the trimmed image and the kept rectangle relative to the source;
+// an image that is entirely border is returned unchanged.
+func trimImage(img image.Image, op types.ImageOperation) (image.Image, image.Rectangle) {
+	src := imaging.Clone(img)
+	bounds := src.Bounds()
+	full := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	if full.Empty() {
+		return src, full
+	}
+
+	tolerance := int(op.Tolerance)
+	border := src.NRGBAAt(0, 0)
+	isBorder := func(x, y int) bool {
+		c := src.NRGBAAt(x, y)
+		if border.A == 0 {
+			return int(c.A) <= tolerance
+		}
+		return withinTolerance(c, border, tolerance)
+	}
+
+	rowIsBorder := func(y int) bool {
+		for x := 0; x < full.Max.X; x++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	colIsBorder := func(x, top, bottom int) bool {
+		for y := top; y < bottom; y++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	top, bottom := 0, full.Max.Y
+	for top < bottom && rowIsBorder(top) {
+		top++
+	}
+	if top == bottom {
+		return src, full
+	}
+	for bottom > top && rowIsBorder(bottom-1) {
+		bottom--
+	}
+
+	left, right := 0, full.Max.X
+	for left < right && colIsBorder(left, top, bottom) {
+		left++
+	}
+	for right > left && colIsBorder(right-1, top, bottom) {
+		right--
+	}
+
+	rect := image.Rect(left, top, right, bottom)
+	return imaging.Crop(src, rect), rect
+}
+
+// withinTolerance reports whether every channel of a and b differs by at
+// most tolerance
+func withinTolerance(a, b color.NRGBA, tolerance int) bool {
+	return absInt(int(a.R)-int(b.R)) <= tolerance &&
+		absInt(int(a.G)-int(b.G)) <= tolerance &&
+		absInt(int(a.B)-int(b.B)) <= tolerance &&
+		absInt(int(a.A)-int(b.A)) <= tolerance
+}
+
+// absInt returns the absolute value of v
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// framedImage fills a w x h canvas with the border color, varied by up to
+// jitter per channel, and draws an opaque red subject in the rectangle
+func framedImage(w, h int, border color.NRGBA, jitter int, subject image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := border
+			if jitter > 0 && (x+y) > 0 {
+				// Keep the top-left pixel exact, it defines the border color
+				d := (x*7 + y*3) % (jitter + 1)
+				if border.A == 0 {
+					c.A = uint8(d)
+				} else {
+					c.R, c.G, c.B = border.R-uint8(d), border.G-uint8(d), border.B-uint8(d)
+				}
+			}
+			if (image.Point{x, y}).In(subject) {
+				c = color.NRGBA{R: 200, G: 30, B: 30, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestTrimImage(t *testing.T) {
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	clear := color.NRGBA{}
+	subject := image.Rect(4, 3, 14, 9)
+
+	tests := []struct {
+		name      string
+		img       *image.NRGBA
+		tolerance float64
+		want      image.Rectangle
+	}{
+		{"uniform border", framedImage(20, 14, white, 0, subject), 0, subject},
+		{"noisy border kept without tolerance", framedImage(20, 14, white, 8, subject), 0, image.Rect(0, 0, 20, 14)},
+		{"noisy border within tolerance", framedImage(20, 14, white, 8, subject), 8, subject},
+		{"transparent border", framedImage(20, 14, clear, 0, subject), 0, subject},
+		{"faint transparent border", framedImage(20, 14, clear, 5, subject), 5, subject},
+		{"subject on the edge", framedImage(20, 14, white, 0, image.Rect(12, 0, 20, 6)), 0, image.Rect(12, 0, 20, 6)},
+		{"no border", framedImage(20, 14, white, 0, image.Rect(0, 0, 20, 14)), 0, image.Rect(0, 0, 20, 14)},
+		{"entirely border", framedImage(20, 14, white, 0, image.Rectangle{}), 0, image.Rect(0, 0, 20, 14)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, rect := trimImage(tt.img, types.ImageOperation{Tolerance: tt.tolerance})
+			if rect != tt.want {
+				t.Errorf("kept %v, want %v", rect, tt.want)
+			}
+			if size := out.Bounds().Size(); size != tt.want.Size() {
+				t.Errorf("size is %v, want %v", size, tt.want.Size())
+			}
+		})
+	}
+}
+
+func TestTrimImageOffsetBounds(t *testing.T) {
+	// Sub-images keep their origin; the kept rectangle is relative to it
+	src := framedImage(20, 14, color.NRGBA{R: 255, G: 255, B: 255, A: 255}, 0, image.Rect(4, 3, 14, 9))
+	sub := src.SubImage(image.Rect(2, 1, 20, 14))
+	_, rect := trimImage(sub, types.ImageOperation{})
+	if want := image.Rect(2, 2, 12, 8); rect != want {
+		t.Errorf("kept %v, want %v", rect, want)
+	}
+}
@@ -0,0 +1,207 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	defaultWatermarkOpacity = 0.5
+	minWatermarkFontSize    = 12
+)
+
+var (
+	watermarkFontOnce sync.Once
+	watermarkFont     *opentype.Font
+	watermarkFontErr  error
+)
+
+// loadWatermarkFont parses the bundled Go Regular font once so the worker
+// does not depend on fonts installed in the container
+func loadWatermarkFont() (*opentype.Font, error) {
+	watermarkFontOnce.Do(func() {
+		watermarkFont, watermarkFontErr = opentype.Parse(goregular.TTF)
+	})
+	return watermarkFont, watermarkFontErr
+}
+
+// addWatermark draws the operation's text or logo watermark onto a copy of the image
+func (p *ImageProcessor) addWatermark(ctx context.Context, img image.Image, op types.ImageOperation) (image.Image, error) {
+	if op.Watermark == "" {
+		return nil, fmt.Errorf("watermark requires text or a logo path")
+	}
+	switch op.WatermarkType {
+	case types.WatermarkText, "":
+		return p.addTextWatermark(img, op)
+	case types.WatermarkLogo:
+		return p.addLogoWatermark(ctx, img, op)
+	default:
+		return nil, fmt.Errorf("unknown watermark type %q", op.WatermarkType)
+	}
+}
+
+// addTextWatermark renders the watermark text with the bundled font
+func (p *ImageProcessor) addTextWatermark(img image.Image, op types.ImageOperation) (image.Image, error) {
+	fnt, err := loadWatermarkFont()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", err)
+	}
+
+	textColor, err := parseColor(op.Color, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	if err != nil {
+		return nil, err
+	}
+	opacity, err := watermarkOpacity(op)
+	if err != nil {
+		return nil, err
+	}
+	textColor.A = uint8(math.Round(float64(textColor.A) * opacity))
+
+	dst := imaging.Clone(img)
+	size := op.FontSize
+	if size <= 0 {
+		size = math.Max(float64(dst.Bounds().Dy())*0.05, minWatermarkFontSize)
+	}
+
+	face, err := opentype.NewFace(fnt, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %w", err)
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+	}
+
+	// Measure the text box so it can be anchored like any other overlay
+	metrics := face.Metrics()
+	ascent := metrics.Ascent.Ceil()
+	textSize := image.Pt(drawer.MeasureString(op.Watermark).Ceil(), ascent+metrics.Descent.Ceil())
+
+	origin, err := watermarkOrigin(dst.Bounds().Size(), textSize, op)
+	if err != nil {
+		return nil, err
+	}
+
+	drawer.Dot = fixed.P(origin.X, origin.Y+ascent)
+	drawer.DrawString(op.Watermark)
+
+	return dst, nil
+}
+
+// addLogoWatermark overlays a logo loaded from object storage, either once
+// at the requested position or tiled across the whole image
+func (p *ImageProcessor) addLogoWatermark(ctx context.Context, img image.Image, op types.ImageOperation) (image.Image, error) {
+	logoSrc, err := p.downloadFromStorage(ctx, op.Watermark, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load logo %s: %w", op.Watermark, err)
+	}
+	logo := logoSrc.image
+
+	opacity, err := watermarkOpacity(op)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := imaging.Clone(img)
+	canvas := dst.Bounds().Size()
+
+	if op.Scale < 0 || op.Scale > 1 {
+		return nil, fmt.Errorf("scale must be between 0 and 1, got %v", op.Scale)
+	}
+	if op.Scale > 0 {
+		width := int(math.Round(float64(canvas.X) * op.Scale))
+		if width < 1 {
+			width = 1
+		}
+		logo = imaging.Resize(logo, width, 0, imaging.Lanczos)
+	}
+
+	mark := logo.Bounds().Size()
+	if mark.X == 0 || mark.Y == 0 {
+		return nil, fmt.Errorf("logo %s is empty", op.Watermark)
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(opacity * 255))})
+
+	if op.Tile {
+		if op.Margin < 0 {
+			return nil, fmt.Errorf("tile margin must not be negative, got %d", op.Margin)
+		}
+		stepX := mark.X + op.Margin
+		stepY := mark.Y + op.Margin
+		for y := op.Margin; y < canvas.Y; y += stepY {
+			for x := op.Margin; x < canvas.X; x += stepX {
+				drawLogo(dst, logo, image.Pt(x, y), mask)
+			}
+		}
+		return dst, nil
+	}
+
+	origin, err := watermarkOrigin(canvas, mark, op)
+	if err != nil {
+		return nil, err
+	}
+	drawLogo(dst, logo, origin, mask)
+
+	return dst, nil
+}
+
+// drawLogo composites the logo over dst at the given point using a
+// uniform alpha mask for opacity
+func drawLogo(dst draw.Image, logo image.Image, at image.Point, mask image.Image) {
+	r := image.Rectangle{Min: at, Max: at.Add(logo.Bounds().Size())}
+	draw.DrawMask(dst, r, logo, logo.Bounds().Min, mask, image.Point{}, draw.Over)
+}
+
+// watermarkOpacity returns the operation's opacity, applying the default
+func watermarkOpacity(op types.ImageOperation) (float64, error) {
+	if op.Opacity == 0 {
+		return defaultWatermarkOpacity, nil
+	}
+	if op.Opacity < 0 || op.Opacity > 1 {
+		return 0, fmt.Errorf("opacity must be between 0 and 1, got %v", op.Opacity)
+	}
+	return op.Opacity, nil
+}
+
+// watermarkOrigin returns the top-left point at which a mark of the given
+// size should be placed on the canvas
+func watermarkOrigin(canvas, mark image.Point, op types.ImageOperation) (image.Point, error) {
+	margin := op.Margin
+
+	switch op.Position {
+	case types.PositionTopLeft:
+		return image.Pt(margin, margin), nil
+	case types.PositionTopRight:
+		return image.Pt(canvas.X-mark.X-margin, margin), nil
+	case types.PositionBottomLeft:
+		return image.Pt(margin, canvas.Y-mark.Y-margin), nil
+	case types.PositionBottomRight, "":
+		return image.Pt(canvas.X-mark.X-margin, canvas.Y-mark.Y-margin), nil
+	case types.PositionCenter:
+		return image.Pt((canvas.X-mark.X)/2, (canvas.Y-mark.Y)/2), nil
+	case types.PositionOffset:
+		return image.Pt(op.OffsetX, op.OffsetY), nil
+	default:
+		return image.Point{}, fmt.Errorf("unknown watermark position %q", op.Position)
+	}
+}
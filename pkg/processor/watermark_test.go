@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestWatermarkOrigin(t *testing.T) {
+	canvas, mark := image.Pt(200, 100), image.Pt(40, 20)
+	tests := []struct {
+		op   types.ImageOperation
+		want image.Point
+	}{
+		{types.ImageOperation{Position: types.PositionTopLeft, Margin: 5}, image.Pt(5, 5)},
+		{types.ImageOperation{Position: types.PositionTopRight, Margin: 5}, image.Pt(155, 5)},
+		{types.ImageOperation{Position: types.PositionBottomLeft, Margin: 5}, image.Pt(5, 75)},
+		{types.ImageOperation{Position: types.PositionBottomRight, Margin: 5}, image.Pt(155, 75)},
+		{types.ImageOperation{Margin: 5}, image.Pt(155, 75)},
+		{types.ImageOperation{Position: types.PositionCenter, Margin: 5}, image.Pt(80, 40)},
+		{types.ImageOperation{Position: types.PositionOffset, OffsetX: 12, OffsetY: 34}, image.Pt(12, 34)},
+	}
+
+	for _, tt := range tests {
+		got, err := watermarkOrigin(canvas, mark, tt.op)
+		if err != nil {
+			t.Fatalf("watermarkOrigin(%q): %v", tt.op.Position, err)
+		}
+		if got != tt.want {
+			t.Errorf("watermarkOrigin(%q) is %v, want %v", tt.op.Position, got, tt.want)
+		}
+	}
+
+	if _, err := watermarkOrigin(canvas, mark, types.ImageOperation{Position: "middle"}); err == nil {
+		t.Errorf("watermarkOrigin accepted an unknown position")
+	}
+}
+
+func TestAddTextWatermark(t *testing.T) {
+	src := imaging.New(200, 100, color.NRGBA{A: 255})
+
+	// Only pixels inside region may change, and some of them must
+	tests := []struct {
+		position string
+		region   image.Rectangle
+	}{
+		{types.PositionTopLeft, image.Rect(0, 0, 100, 50)},
+		{types.PositionTopRight, image.Rect(100, 0, 200, 50)},
+		{types.PositionBottomLeft, image.Rect(0, 50, 100, 100)},
+		{types.PositionBottomRight, image.Rect(100, 50, 200, 100)},
+		{types.PositionCenter, image.Rect(50, 25, 150, 75)},
+		{types.PositionOffset, image.Rect(120, 60, 200, 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			op := types.ImageOperation{
+				Type:      types.OpWatermark,
+				Watermark: "HI",
+				Position:  tt.position,
+				FontSize:  20,
+				Opacity:   1,
+				Margin:    5,
+				OffsetX:   130,
+				OffsetY:   65,
+			}
+			out, err := (&ImageProcessor{}).addWatermark(context.Background(), src, op)
+			if err != nil {
+				t.Fatalf("addWatermark: %v", err)
+			}
+
+			nrgba := imaging.Clone(out)
+			inside, outside := 0, 0
+			for y := 0; y < 100; y++ {
+				for x := 0; x < 200; x++ {
+					if nrgba.NRGBAAt(x, y) == src.NRGBAAt(x, y) {
+						continue
+					}
+					if image.Pt(x, y).In(tt.region) {
+						inside++
+					} else {
+						outside++
+					}
+				}
+			}
+			if inside == 0 {
+				t.Errorf("no pixels changed inside %v", tt.region)
+			}
+			if outside != 0 {
+				t.Errorf("%d pixels changed outside %v", outside, tt.region)
+			}
+		})
+	}
+}
+
+func TestAddWatermarkErrors(t *testing.T) {
+	src := imaging.New(20, 10, color.NRGBA{A: 255})
+	tests := []struct {
+		name string
+		op   types.ImageOperation
+	}{
+		{"empty text", types.ImageOperation{Type: types.OpWatermark}},
+		{"unknown type", types.ImageOperation{Type: types.OpWatermark, Watermark: "x", WatermarkType: "stamp"}},
+		{"unknown position", types.ImageOperation{Type: types.OpWatermark, Watermark: "x", Position: "middle"}},
+		{"opacity out of range", types.ImageOperation{Type: types.OpWatermark, Watermark: "x", Opacity: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (&ImageProcessor{}).addWatermark(context.Background(), src, tt.op); err == nil {
+				t.Errorf("addWatermark succeeded, want an error")
+			}
+		})
+	}
+}
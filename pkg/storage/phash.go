@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"event-driven-image-pipeline/pkg/phash"
+	"event-driven-image-pipeline/pkg/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// hashIndexKey is the Redis sorted set of indexed jobs. Members are the
+// JSON encoded entries, scored by the Unix time their job expires, so
+// entries can be pruned together with the job keys.
+const hashIndexKey = "phash:jobs"
+
+// hashIndexScanLimit bounds how many entries a lookup compares. Lookups are
+// a linear scan, O(n) in the index size per job, so only the most recently
+// indexed jobs are considered.
+const hashIndexScanLimit = 10000
+
+// HashIndex stores the perceptual hashes of processed jobs in Redis for
+// near-duplicate lookups
+type HashIndex struct {
+	rdb *redis.Client
+}
+
+// hashIndexEntry is a member of the index
+type hashIndexEntry struct {
+	JobID          string `json:"job_id"`
+	ImageURL       string `json:"image_url"`
+	PerceptualHash string `json:"perceptual_hash"`
+}
+
+// NewHashIndex creates a hash index backed by the Redis client
+func NewHashIndex(rdb *redis.Client) *HashIndex {
+	return &HashIndex{rdb: rdb}
+}
+
+// Add indexes the job's perceptual hash until ttl has passed, which should
+// match the expiry of the job itself
+func (ix *HashIndex) Add(ctx context.Context, job types.Job, ttl time.Duration) error {
+	member, err := json.Marshal(hashIndexEntry{
+		JobID:          job.ID,
+		ImageURL:       job.ImageURL,
+		PerceptualHash: job.PerceptualHash,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode index entry: %w", err)
+	}
+
+	if err := ix.prune(ctx); err != nil {
+		return err
+	}
+	expires := float64(time.Now().Add(ttl).Unix())
+	if err := ix.rdb.ZAdd(ctx, hashIndexKey, redis.Z{Score: expires, Member: member}).Err(); err != nil {
+		return fmt.Errorf("failed to index job: %w", err)
+	}
+	return nil
+}
+
+// FindSimilar returns the indexed jobs whose hash is within maxDistance bits
+// of hash, closest first. Only the hashIndexScanLimit most recently indexed
+// jobs are compared.
+func (ix *HashIndex) FindSimilar(ctx context.Context, hash uint64, maxDistance int) ([]types.SimilarJob, error) {
+	if err := ix.prune(ctx); err != nil {
+		return nil, err
+	}
+	// Later expiries were indexed later, so the newest entries come first
+	members, err := ix.rdb.ZRevRange(ctx, hashIndexKey, 0, hashIndexScanLimit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash index: %w", err)
+	}
+	return matchEntries(members, hash, maxDistance), nil
+}
+
+// matchEntries decodes the index members and keeps those within maxDistance
+// bits of hash, closest first. Members that cannot be decoded are skipped.
+func matchEntries(members []string, hash uint64, maxDistance int) []types.SimilarJob {
+	matches := []types.SimilarJob{}
+	for _, member := range members {
+		var entry hashIndexEntry
+		if err := json.Unmarshal([]byte(member), &entry); err != nil {
+			continue
+		}
+		h, err := phash.Parse(entry.PerceptualHash)
+		if err != nil {
+			continue
+		}
+		distance := phash.Distance(hash, h)
+		if distance > maxDistance {
+			continue
+		}
+		matches = append(matches, types.SimilarJob{
+			JobID:          entry.JobID,
+			ImageURL:       entry.ImageURL,
+			PerceptualHash: entry.PerceptualHash,
+			Distance:       distance,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].JobID < matches[j].JobID
+	})
+	return matches
+}
+
+// prune removes the entries of expired jobs
+func (ix *HashIndex) prune(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := ix.rdb.ZRemRangeByScore(ctx, hashIndexKey, "-inf", now).Err(); err != nil {
+		return fmt.Errorf("failed to prune hash index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"event-driven-image-pipeline/pkg/phash"
+	"event-driven-image-pipeline/pkg/types"
+)
+
+// indexMember encodes an index entry the way Add stores it
+func indexMember(t *testing.T, jobID string, hash uint64) string {
+	t.Helper()
+	member, err := json.Marshal(hashIndexEntry{JobID: jobID, ImageURL: jobID + ".jpg", PerceptualHash: phash.Format(hash)})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	return string(member)
+}
+
+func TestMatchEntries(t *testing.T) {
+	const hash = 0x0123456789abcdef
+	members := []string{
+		indexMember(t, "far", hash^0xffff),        // 16 bits differ
+		indexMember(t, "limit", hash^0x3ff),       // 10 bits
+		indexMember(t, "b-near", hash^0b101),      // 2 bits
+		indexMember(t, "a-near", hash^0b11<<40),   // 2 bits
+		indexMember(t, "exact", hash),             // 0 bits
+		indexMember(t, "over", hash^0x7ff),        // 11 bits
+		"not json",                                // skipped
+		`{"job_id":"bad","perceptual_hash":"zz"}`, // skipped
+	}
+
+	tests := []struct {
+		maxDistance int
+		want        []string
+	}{
+		{0, []string{"exact"}},
+		{2, []string{"exact", "a-near", "b-near"}},
+		{phash.DefaultMaxDistance, []string{"exact", "a-near", "b-near", "limit"}},
+		{64, []string{"exact", "a-near", "b-near", "limit", "over", "far"}},
+	}
+	for _, tt := range tests {
+		got := matchEntries(members, hash, tt.maxDistance)
+		if len(got) != len(tt.want) {
+			t.Errorf("max distance %d: got %d matches %+v, want %v", tt.maxDistance, len(got), got, tt.want)
+			continue
+		}
+		for i, m := range got {
+			if m.JobID != tt.want[i] {
+				t.Errorf("max distance %d: match %d is %s, want %s", tt.maxDistance, i, m.JobID, tt.want[i])
+			}
+			if d := phash.Distance(hash, mustParse(t, m.PerceptualHash)); m.Distance != d || d > tt.maxDistance {
+				t.Errorf("max distance %d: %s has distance %d, hashes differ by %d", tt.maxDistance, m.JobID, m.Distance, d)
+			}
+		}
+	}
+
+	if got := matchEntries(nil, hash, 64); got == nil || len(got) != 0 {
+		t.Errorf("empty index gave %#v, want an empty list", got)
+	}
+}
+
+func TestMatchEntriesKeepsDetails(t *testing.T) {
+	got := matchEntries([]string{indexMember(t, "job", 42)}, 43, 1)
+	want := []types.SimilarJob{{JobID: "job", ImageURL: "job.jpg", PerceptualHash: phash.Format(42), Distance: 1}}
+	if len(got) != 1 || got[0] != want[0] {
+		t.Errorf("matches are %+v, want %+v", got, want)
+	}
+}
+
+func mustParse(t *testing.T, s string) uint64 {
+	t.Helper()
+	hash, err := phash.Parse(s)
+	if err != nil {
+		t.Fatalf("phash.Parse: %v", err)
+	}
+	return hash
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"slices"
 	"time"
 )
 
@@ -10,35 +11,268 @@ type Job struct {
 	Status      string           `json:"status"`
 	ImageURL    string           `json:"image_url"`
 	Operations  []ImageOperation `json:"operations"`
+	Outputs     []OutputSpec     `json:"outputs,omitempty"`
 	CreatedAt   time.Time        `json:"created_at"`
 	CompletedAt *time.Time       `json:"completed_at,omitempty"`
 	Results     []ProcessedImage `json:"results,omitempty"`
+	Errors      []OutputError    `json:"errors,omitempty"` // outputs and operations that failed; the rest are still in Results
 	Error       string           `json:"error,omitempty"`
+	Options     JobOptions       `json:"options"`
+	Placeholder *Placeholder     `json:"placeholder,omitempty"`
+
+	PerceptualHash string         `json:"perceptual_hash,omitempty"` // 64-bit dHash of the source image, hex encoded
+	Duplicates     []SimilarJob   `json:"duplicates,omitempty"`      // previously processed jobs with a near-duplicate source, found before rendering
+	Analysis       *ColorAnalysis `json:"analysis,omitempty"`        // source colors, when the analyze option is set
+	Metadata       *ImageMetadata `json:"metadata,omitempty"`        // source metadata groups requested in the options
+}
+
+// JobOptions holds settings that apply to the whole job
+type JobOptions struct {
+	AutoOrient  *bool  `json:"auto_orient,omitempty"`  // apply the EXIF orientation on decode, defaults to true
+	Placeholder string `json:"placeholder,omitempty"`  // blurhash or thumbhash string to compute from the source
+	LQIP        bool   `json:"lqip,omitempty"`         // compute a tiny base64 data URI of the source
+	Analyze     bool   `json:"analyze,omitempty"`      // extract the average and dominant colors of the source
+	PaletteSize int    `json:"palette_size,omitempty"` // number of dominant colors to extract, defaults to 5
+
+	Metadata []string `json:"metadata,omitempty"` // metadata groups to extract from the source: exif, gps, iptc, xmp or all
+}
+
+// AutoOrientEnabled reports whether EXIF auto-orientation should be applied
+func (o JobOptions) AutoOrientEnabled() bool {
+	return o.AutoOrient == nil || *o.AutoOrient
+}
+
+// SimilarJob is a previously processed job whose source image is a near
+// duplicate
+type SimilarJob struct {
+	JobID          string `json:"job_id"`
+	ImageURL       string `json:"image_url"`
+	PerceptualHash string `json:"perceptual_hash"`
+	Distance       int    `json:"distance"` // Hamming distance between the hashes
+}
+
+// Placeholder holds loading placeholders computed from the source image
+type Placeholder struct {
+	BlurHash  string `json:"blurhash,omitempty"`
+	ThumbHash string `json:"thumbhash,omitempty"` // base64 encoded
+	LQIP      string `json:"lqip,omitempty"`      // data URI of a tiny copy of the image
+}
+
+// ColorAnalysis describes the colors of the source image
+type ColorAnalysis struct {
+	AverageColor   string          `json:"average_color"`   // hex color
+	DominantColors []DominantColor `json:"dominant_colors"` // most common first
+}
+
+// DominantColor is one entry of the dominant color palette
+type DominantColor struct {
+	Color      string  `json:"color"`      // hex color
+	Proportion float64 `json:"proportion"` // share of the opaque pixels, 0-1
 }
 
 // ImageOperation defines what should be done to the image
 type ImageOperation struct {
-	Type      string `json:"type"`       // resize, format, watermark
-	Width     int    `json:"width"`      // for resize operations
-	Height    int    `json:"height"`     // for resize operations
-	Format    string `json:"format"`     // jpeg, png, webp
-	Quality   int    `json:"quality"`    // 1-100 for JPEG/WebP
+	Type      string `json:"type"`       // resize, format, watermark, crop, trim, mask, border, responsive, rotate, flip, blur, sharpen, unsharp, adjust, effect
+	Width     int    `json:"width"`      // for resize and crop operations
+	Height    int    `json:"height"`     // for resize and crop operations
+	Format    string `json:"format"`     // jpeg, png, webp, gif, bmp, tiff
+	Quality   int    `json:"quality"`    // 1-100 for JPEG; WebP output is always lossless
 	Watermark string `json:"watermark"`  // watermark text or logo path
 	OutputKey string `json:"output_key"` // unique key for this output
+
+	// Animated GIF sources
+	Frame *int `json:"frame,omitempty"` // extract this frame (0-based) as a still poster image
+
+	// Source metadata and color profile written to the output. Sources are
+	// converted to sRGB using their embedded ICC profile; CMYK JPEGs without
+	// one fall back to a naive conversion and can look too saturated.
+	Metadata string `json:"metadata,omitempty"`  // strip (default), keep, copyright or strip_gps
+	EmbedICC bool   `json:"embed_icc,omitempty"` // embed an sRGB ICC profile
+
+	// Encoded size budget
+	MaxBytes       int64 `json:"max_bytes,omitempty"`       // largest allowed output size; JPEG quality is lowered until it fits
+	AllowDownscale bool  `json:"allow_downscale,omitempty"` // shrink the image when the lowest quality still exceeds max_bytes
+
+	// Perceptual JPEG quality selection
+	AutoQuality bool    `json:"auto_quality,omitempty"` // pick the lowest quality, up to Quality when set, that keeps MinSSIM
+	MinSSIM     float64 `json:"min_ssim,omitempty"`     // SSIM to keep against the unencoded image, 0-1, defaults to 0.98
+
+	// Resize fit mode
+	Fit string `json:"fit,omitempty"` // fill (default), contain, cover or pad when both width and height are set; cover and pad honor Gravity
+
+	// Watermark placement and styling
+	WatermarkType string  `json:"watermark_type,omitempty"` // text (default) or logo
+	Position      string  `json:"position,omitempty"`       // top-left, top-right, bottom-left, bottom-right, center, offset
+	OffsetX       int     `json:"offset_x,omitempty"`       // x position when position is "offset"
+	OffsetY       int     `json:"offset_y,omitempty"`       // y position when position is "offset"
+	FontSize      float64 `json:"font_size,omitempty"`      // text size in pixels, defaults to 5% of the image height
+	Color         string  `json:"color,omitempty"`          // hex text or border color, e.g. #ffffff or #ffffff80
+	Opacity       float64 `json:"opacity,omitempty"`        // 0-1, defaults to 0.5
+	Margin        int     `json:"margin,omitempty"`         // distance from the image edge (or between tiles) in pixels
+	Scale         float64 `json:"scale,omitempty"`          // logo width relative to the image width, 0-1
+	Tile          bool    `json:"tile,omitempty"`           // repeat the logo across the whole image
+
+	// Crop region: an explicit rectangle at X/Y, or Width/Height anchored by Gravity
+	X       int    `json:"x,omitempty"`       // left edge of the crop rectangle
+	Y       int    `json:"y,omitempty"`       // top edge of the crop rectangle
+	Gravity string `json:"gravity,omitempty"` // north, north-east, east, south-east, south, south-west, west, north-west, center, smart
+
+	// Trim of uniform or transparent borders
+	Tolerance float64 `json:"tolerance,omitempty"` // maximum per-channel difference from the border color, 0-255
+
+	// Masks and borders; masked JPEG and BMP output is flattened onto Background
+	Shape       string `json:"shape,omitempty"`        // rounded, circle or ellipse
+	BorderWidth int    `json:"border_width,omitempty"` // border thickness in pixels
+
+	// Responsive variants: explicit widths, or MinWidth to MaxWidth in WidthStep increments
+	Widths    []int    `json:"widths,omitempty"`     // variant widths in pixels, larger than the source are skipped
+	MinWidth  int      `json:"min_width,omitempty"`  // smallest variant width when widths is empty
+	MaxWidth  int      `json:"max_width,omitempty"`  // largest variant width when widths is empty
+	WidthStep int      `json:"width_step,omitempty"` // increment between min_width and max_width
+	Formats   []string `json:"formats,omitempty"`    // one variant per width in each format, defaults to format
+
+	// Rotate, flip and background fill
+	Angle      float64 `json:"angle,omitempty"`      // counter-clockwise rotation in degrees
+	Background string  `json:"background,omitempty"` // hex fill color for uncovered or padded areas (default transparent) and for flattening alpha in JPEG and BMP output (default white)
+	Direction  string  `json:"direction,omitempty"`  // horizontal or vertical
+
+	// Blur, sharpen and unsharp mask
+	Sigma     float64 `json:"sigma,omitempty"`     // blur/sharpen strength, defaults to 1
+	Radius    float64 `json:"radius,omitempty"`    // unsharp mask blur radius (default 1) or rounded mask corner radius in pixels
+	Amount    float64 `json:"amount,omitempty"`    // unsharp mask strength, 1 = 100%, defaults to 1
+	Threshold float64 `json:"threshold,omitempty"` // unsharp mask minimum difference to sharpen, 0-255
+
+	// Tonal and color adjustments, zero leaves the image unchanged
+	Brightness float64 `json:"brightness,omitempty"` // percentage, -100 to 100
+	Contrast   float64 `json:"contrast,omitempty"`   // percentage, -100 to 100
+	Gamma      float64 `json:"gamma,omitempty"`      // 0.1 to 10, 1 is neutral
+	Saturation float64 `json:"saturation,omitempty"` // percentage, -100 to 500
+	Hue        float64 `json:"hue,omitempty"`        // shift in degrees, -180 to 180
+
+	// Stylistic effects
+	Effect         string `json:"effect,omitempty"`          // grayscale, sepia, invert or duotone
+	ShadowColor    string `json:"shadow_color,omitempty"`    // duotone color for dark tones, defaults to black
+	HighlightColor string `json:"highlight_color,omitempty"` // duotone color for light tones, defaults to white
+}
+
+// ResponsiveWidths returns the variant widths of a responsive operation in
+// ascending order, without duplicates
+func (op ImageOperation) ResponsiveWidths() []int {
+	var widths []int
+	if len(op.Widths) > 0 {
+		widths = append(widths, op.Widths...)
+	} else if op.WidthStep > 0 {
+		for w := op.MinWidth; w <= op.MaxWidth; w += op.WidthStep {
+			widths = append(widths, w)
+		}
+		if len(widths) > 0 && widths[len(widths)-1] != op.MaxWidth {
+			widths = append(widths, op.MaxWidth)
+		}
+	}
+
+	slices.Sort(widths)
+	return slices.Compact(widths)
+}
+
+// OutputSpec describes a single output: an ordered list of steps applied to
+// the source image, followed by one encode
+type OutputSpec struct {
+	Steps      []ImageOperation `json:"steps"`
+	Format     string           `json:"format"`               // jpeg, png, webp, gif, bmp, tiff
+	Quality    int              `json:"quality"`              // 1-100 for JPEG; WebP output is always lossless
+	OutputKey  string           `json:"output_key"`           // unique key for this output
+	Frame      *int             `json:"frame,omitempty"`      // extract this frame (0-based) of an animated source as a still poster image
+	Background string           `json:"background,omitempty"` // hex color for flattening alpha in JPEG and BMP output, defaults to white
+	Metadata   string           `json:"metadata,omitempty"`   // source metadata to keep in JPEG, PNG and WebP output: strip (default), keep, copyright or strip_gps
+	EmbedICC   bool             `json:"embed_icc,omitempty"`  // embed an sRGB ICC profile in JPEG, PNG and WebP output; pixels are always sRGB, naively converted for CMYK sources without a profile
+
+	// Encoded size budget
+	MaxBytes       int64 `json:"max_bytes,omitempty"`       // largest allowed output size; JPEG quality is lowered from Quality until it fits
+	AllowDownscale bool  `json:"allow_downscale,omitempty"` // shrink the image when the lowest quality (or a lossless format) still exceeds max_bytes
+
+	// Perceptual JPEG quality selection, applied before max_bytes
+	AutoQuality bool    `json:"auto_quality,omitempty"` // pick the lowest JPEG quality, up to Quality when set, whose SSIM stays at or above MinSSIM
+	MinSSIM     float64 `json:"min_ssim,omitempty"`     // SSIM to keep against the unencoded image, 0-1, defaults to 0.98
+}
+
+// AsOutput converts a flat operation into the equivalent single-step output
+func (op ImageOperation) AsOutput() OutputSpec {
+	return OutputSpec{
+		Steps:      []ImageOperation{op},
+		Format:     op.Format,
+		Quality:    op.Quality,
+		OutputKey:  op.OutputKey,
+		Frame:      op.Frame,
+		Background: op.Background,
+		Metadata:   op.Metadata,
+		EmbedICC:   op.EmbedICC,
+
+		MaxBytes:       op.MaxBytes,
+		AllowDownscale: op.AllowDownscale,
+
+		AutoQuality: op.AutoQuality,
+		MinSSIM:     op.MinSSIM,
+	}
 }
 
 // ProcessedImage represents the result of image processing
 type ProcessedImage struct {
 	Operation      ImageOperation `json:"operation"`
+	Output         *OutputSpec    `json:"output,omitempty"` // the output spec, for results of Outputs rather than flat Operations
 	OutputURL      string         `json:"output_url"`
 	OutputKey      string         `json:"output_key"`
 	Size           int64          `json:"size"` // file size in bytes
 	Width          int            `json:"width"`
 	Height         int            `json:"height"`
 	Format         string         `json:"format"`
+	Quality        int            `json:"quality,omitempty"` // JPEG quality the output was encoded at
+	SSIM           float64        `json:"ssim,omitempty"`    // similarity of an auto quality output to the unencoded image
 	ProcessingTime time.Duration  `json:"processing_time"`
+	CropRect       *Rect          `json:"crop_rect,omitempty"`   // region of the source that was kept by a crop or a cover resize
+	TrimRect       *Rect          `json:"trim_rect,omitempty"`   // bounding box of the subject that was kept by a trim
+	FrameCount     int            `json:"frame_count,omitempty"` // number of frames in an animated output
+	Duration       time.Duration  `json:"duration,omitempty"`    // total playback time of an animated output
+	Flattened      bool           `json:"flattened,omitempty"`   // transparency was composited onto the background color
+
+	// Responsive manifest results
+	Manifest *ResponsiveManifest `json:"manifest,omitempty"` // variants listed in the uploaded manifest
+}
+
+// OutputError records why an output or flat operation produced no result
+type OutputError struct {
+	Output string `json:"output"` // the failed entry, e.g. outputs[1] or operations[0]
+	Error  string `json:"error"`
+}
+
+// ResponsiveManifest describes the variants of a responsive operation, for
+// building srcset and <picture> markup
+type ResponsiveManifest struct {
+	Variants []ResponsiveVariant `json:"variants"`
+}
+
+// ResponsiveVariant is a single rendered width and format
+type ResponsiveVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"` // file size in bytes
+	Key    string `json:"key"`
+}
+
+// Rect is a rectangle in source image pixel coordinates
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
+// Placeholder type constants
+const (
+	PlaceholderBlurHash  = "blurhash"
+	PlaceholderThumbHash = "thumbhash"
+)
+
 // JobStatus constants
 const (
 	StatusPending    = "pending"
@@ -49,9 +283,80 @@ const (
 
 // OperationType constants
 const (
-	OpResize    = "resize"
-	OpFormat    = "format"
-	OpWatermark = "watermark"
+	OpResize     = "resize"
+	OpFormat     = "format"
+	OpWatermark  = "watermark"
+	OpCrop       = "crop"
+	OpTrim       = "trim"
+	OpMask       = "mask"
+	OpBorder     = "border"
+	OpResponsive = "responsive"
+	OpRotate     = "rotate"
+	OpFlip       = "flip"
+	OpBlur       = "blur"
+	OpSharpen    = "sharpen"
+	OpUnsharp    = "unsharp"
+	OpAdjust     = "adjust"
+	OpEffect     = "effect"
+)
+
+// Effect constants
+const (
+	EffectGrayscale = "grayscale"
+	EffectSepia     = "sepia"
+	EffectInvert    = "invert"
+	EffectDuotone   = "duotone"
+)
+
+// MaskShape constants
+const (
+	MaskRounded = "rounded" // rounded corners with the given radius
+	MaskCircle  = "circle"  // largest circle, anchored by gravity
+	MaskEllipse = "ellipse" // ellipse inscribed in the image
+)
+
+// FitMode constants
+const (
+	FitFill    = "fill"    // stretch to exactly width x height
+	FitContain = "contain" // scale to fit inside width x height, keeping the aspect ratio
+	FitCover   = "cover"   // scale to cover width x height, then crop to exactly width x height
+	FitPad     = "pad"     // contain, then pad to exactly width x height with the background color
+)
+
+// FlipDirection constants
+const (
+	FlipHorizontal = "horizontal"
+	FlipVertical   = "vertical"
+)
+
+// WatermarkType constants
+const (
+	WatermarkText = "text"
+	WatermarkLogo = "logo"
+)
+
+// WatermarkPosition constants
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+	PositionOffset      = "offset"
+)
+
+// Gravity constants
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravityNorthEast = "north-east"
+	GravityEast      = "east"
+	GravitySouthEast = "south-east"
+	GravitySouth     = "south"
+	GravitySouthWest = "south-west"
+	GravityWest      = "west"
+	GravityNorthWest = "north-west"
+	GravitySmart     = "smart"
 )
 
 // ImageFormat constants
@@ -59,4 +364,8 @@ const (
 	FormatJPEG = "jpeg"
 	FormatPNG  = "png"
 	FormatWebP = "webp"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatTIFF = "tiff"
+	FormatJSON = "json" // responsive manifests
 )
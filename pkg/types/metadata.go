@@ -0,0 +1,67 @@
+package types
+
+// ImageMetadata holds the metadata groups extracted from the source image
+type ImageMetadata struct {
+	EXIF *EXIFData      `json:"exif,omitempty"`
+	GPS  *GPSData       `json:"gps,omitempty"`
+	IPTC *IPTCData      `json:"iptc,omitempty"`
+	XMP  map[string]any `json:"xmp,omitempty"` // properties keyed by prefix:name, lists as arrays
+}
+
+// EXIFData holds the camera and capture fields of the EXIF block
+type EXIFData struct {
+	Make         string  `json:"make,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	LensMake     string  `json:"lens_make,omitempty"`
+	LensModel    string  `json:"lens_model,omitempty"`
+	Software     string  `json:"software,omitempty"`
+	Artist       string  `json:"artist,omitempty"`
+	Copyright    string  `json:"copyright,omitempty"`
+	Description  string  `json:"description,omitempty"`
+	CaptureTime  string  `json:"capture_time,omitempty"`  // RFC 3339, without a zone when the file has no offset
+	ModifyTime   string  `json:"modify_time,omitempty"`   // RFC 3339, without a zone when the file has no offset
+	Orientation  int     `json:"orientation,omitempty"`   // 1-8 as stored, before auto-orientation
+	ExposureTime string  `json:"exposure_time,omitempty"` // e.g. "1/250" or "2"
+	FNumber      float64 `json:"f_number,omitempty"`
+	FocalLength  float64 `json:"focal_length,omitempty"` // millimeters
+	ISO          int     `json:"iso,omitempty"`
+}
+
+// GPSData is the capture location in decimal degrees
+type GPSData struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"` // meters above sea level
+}
+
+// IPTCData holds the editorial fields of the IPTC IIM block
+type IPTCData struct {
+	Title       string   `json:"title,omitempty"`
+	Headline    string   `json:"headline,omitempty"`
+	Caption     string   `json:"caption,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Creators    []string `json:"creators,omitempty"`
+	Credit      string   `json:"credit,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Copyright   string   `json:"copyright,omitempty"`
+	City        string   `json:"city,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	DateCreated string   `json:"date_created,omitempty"` // YYYY-MM-DD
+}
+
+// Metadata group constants
+const (
+	MetadataEXIF = "exif"
+	MetadataGPS  = "gps"
+	MetadataIPTC = "iptc"
+	MetadataXMP  = "xmp"
+	MetadataAll  = "all"
+)
+
+// Metadata policy constants, choosing which source metadata an output keeps
+const (
+	MetadataStrip     = "strip"
+	MetadataKeep      = "keep"
+	MetadataCopyright = "copyright" // only the copyright notice and orientation
+	MetadataStripGPS  = "strip_gps"
+)
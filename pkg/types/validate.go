@@ -0,0 +1,353 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parameter limits enforced by Validate
+const (
+	MaxBlurSigma     = 100
+	MaxSharpenSigma  = 10
+	MaxUnsharpRadius = 50
+	MaxUnsharpAmount = 5
+	MaxThreshold     = 255
+	MinGamma         = 0.1
+	MaxGamma         = 10
+	MaxSaturation    = 500
+	MaxBorderWidth   = 1000
+	MaxDimension     = 8192
+	MaxVariantWidth  = 8192
+	MaxVariants      = 32
+	MaxPaletteSize   = 16
+)
+
+// knownOperations lists every supported operation type
+var knownOperations = map[string]bool{
+	OpResize:     true,
+	OpFormat:     true,
+	OpWatermark:  true,
+	OpCrop:       true,
+	OpTrim:       true,
+	OpMask:       true,
+	OpBorder:     true,
+	OpResponsive: true,
+	OpRotate:     true,
+	OpFlip:       true,
+	OpBlur:       true,
+	OpSharpen:    true,
+	OpUnsharp:    true,
+	OpAdjust:     true,
+	OpEffect:     true,
+}
+
+// knownEffects lists every supported effect
+var knownEffects = map[string]bool{
+	EffectGrayscale: true,
+	EffectSepia:     true,
+	EffectInvert:    true,
+	EffectDuotone:   true,
+}
+
+// knownFormats lists every supported output image format
+var knownFormats = map[string]bool{
+	FormatJPEG: true,
+	FormatPNG:  true,
+	FormatWebP: true,
+	FormatGIF:  true,
+	FormatBMP:  true,
+	FormatTIFF: true,
+}
+
+// knownFitModes lists every supported resize fit mode
+var knownFitModes = map[string]bool{
+	FitFill:    true,
+	FitContain: true,
+	FitCover:   true,
+	FitPad:     true,
+}
+
+// knownGravities lists every supported crop and fit anchor
+var knownGravities = map[string]bool{
+	GravityCenter:    true,
+	GravityNorth:     true,
+	GravityNorthEast: true,
+	GravityEast:      true,
+	GravitySouthEast: true,
+	GravitySouth:     true,
+	GravitySouthWest: true,
+	GravityWest:      true,
+	GravityNorthWest: true,
+	GravitySmart:     true,
+}
+
+// knownPositions lists every supported watermark position
+var knownPositions = map[string]bool{
+	PositionTopLeft:     true,
+	PositionTopRight:    true,
+	PositionBottomLeft:  true,
+	PositionBottomRight: true,
+	PositionCenter:      true,
+	PositionOffset:      true,
+}
+
+// knownWatermarkTypes lists every supported watermark type
+var knownWatermarkTypes = map[string]bool{
+	WatermarkText: true,
+	WatermarkLogo: true,
+}
+
+// knownMetadataGroups lists every metadata group that can be extracted
+var knownMetadataGroups = map[string]bool{
+	MetadataEXIF: true,
+	MetadataGPS:  true,
+	MetadataIPTC: true,
+	MetadataXMP:  true,
+	MetadataAll:  true,
+}
+
+// knownMetadataPolicies lists every supported output metadata policy
+var knownMetadataPolicies = map[string]bool{
+	MetadataStrip:     true,
+	MetadataKeep:      true,
+	MetadataCopyright: true,
+	MetadataStripGPS:  true,
+}
+
+// knownMaskShapes lists every supported mask shape
+var knownMaskShapes = map[string]bool{
+	MaskRounded: true,
+	MaskCircle:  true,
+	MaskEllipse: true,
+}
+
+// Validate checks that the operation type is known and that its parameters
+// are within the supported ranges
+func (op ImageOperation) Validate() error {
+	if !knownOperations[op.Type] {
+		return fmt.Errorf("unknown operation type %q", op.Type)
+	}
+	if err := op.AsOutput().validateEncoding(); err != nil {
+		return err
+	}
+	if op.Fit != "" && !knownFitModes[op.Fit] {
+		return fmt.Errorf("unknown fit mode %q", op.Fit)
+	}
+	if op.Gravity != "" && !knownGravities[op.Gravity] {
+		return fmt.Errorf("unknown gravity %q", op.Gravity)
+	}
+	if op.Fit == FitPad && op.Gravity == GravitySmart {
+		return fmt.Errorf("smart gravity is not supported with fit pad")
+	}
+	if op.Position != "" && !knownPositions[op.Position] {
+		return fmt.Errorf("unknown watermark position %q", op.Position)
+	}
+	if op.Width < 0 || op.Width > MaxDimension || op.Height < 0 || op.Height > MaxDimension {
+		return fmt.Errorf("width and height must be between 0 and %d, got %dx%d", MaxDimension, op.Width, op.Height)
+	}
+	for _, c := range []struct{ name, value string }{
+		{"color", op.Color},
+		{"shadow_color", op.ShadowColor},
+		{"highlight_color", op.HighlightColor},
+	} {
+		if err := checkColor(c.name, c.value); err != nil {
+			return err
+		}
+	}
+
+	switch op.Type {
+	case OpWatermark:
+		if op.Watermark == "" {
+			return fmt.Errorf("watermark requires text or a logo path")
+		}
+		if op.WatermarkType != "" && !knownWatermarkTypes[op.WatermarkType] {
+			return fmt.Errorf("unknown watermark type %q", op.WatermarkType)
+		}
+		if err := checkRange("opacity", op.Opacity, 0, 1); err != nil {
+			return err
+		}
+		if err := checkRange("scale", op.Scale, 0, 1); err != nil {
+			return err
+		}
+		if op.FontSize < 0 {
+			return fmt.Errorf("font_size must not be negative, got %v", op.FontSize)
+		}
+		if op.Tile && op.Margin < 0 {
+			return fmt.Errorf("tile margin must not be negative, got %d", op.Margin)
+		}
+	case OpCrop:
+		if op.Width < 1 || op.Height < 1 {
+			return fmt.Errorf("crop requires a positive width and height, got %dx%d", op.Width, op.Height)
+		}
+		if op.X < 0 || op.Y < 0 {
+			return fmt.Errorf("crop x and y must not be negative, got (%d,%d)", op.X, op.Y)
+		}
+	case OpTrim:
+		if err := checkRange("tolerance", op.Tolerance, 0, MaxThreshold); err != nil {
+			return err
+		}
+	case OpMask:
+		if !knownMaskShapes[op.Shape] {
+			return fmt.Errorf("unknown mask shape %q", op.Shape)
+		}
+		if op.Shape == MaskRounded && op.Radius <= 0 {
+			return fmt.Errorf("rounded mask requires a positive radius")
+		}
+	case OpBorder:
+		if op.BorderWidth < 1 || op.BorderWidth > MaxBorderWidth {
+			return fmt.Errorf("border_width must be between 1 and %d, got %d", MaxBorderWidth, op.BorderWidth)
+		}
+	case OpResponsive:
+		if len(op.Widths) == 0 {
+			if op.MinWidth < 1 || op.MaxWidth < op.MinWidth || op.WidthStep < 1 {
+				return fmt.Errorf("responsive requires widths or a min_width, max_width and width_step range")
+			}
+			if op.MaxWidth > MaxVariantWidth {
+				return fmt.Errorf("max_width must be at most %d, got %d", MaxVariantWidth, op.MaxWidth)
+			}
+		}
+		widths := op.ResponsiveWidths()
+		for _, w := range widths {
+			if w < 1 || w > MaxVariantWidth {
+				return fmt.Errorf("responsive widths must be between 1 and %d, got %d", MaxVariantWidth, w)
+			}
+		}
+		if n := len(widths) * max(len(op.Formats), 1); n > MaxVariants {
+			return fmt.Errorf("responsive would produce %d variants, at most %d are allowed", n, MaxVariants)
+		}
+		for _, format := range op.Formats {
+			if !knownFormats[format] {
+				return fmt.Errorf("unknown format %q", format)
+			}
+		}
+	case OpFlip:
+		if op.Direction != FlipHorizontal && op.Direction != FlipVertical {
+			return fmt.Errorf("unknown flip direction %q", op.Direction)
+		}
+	case OpBlur:
+		if err := checkRange("sigma", op.Sigma, 0, MaxBlurSigma); err != nil {
+			return err
+		}
+	case OpSharpen:
+		if err := checkRange("sigma", op.Sigma, 0, MaxSharpenSigma); err != nil {
+			return err
+		}
+	case OpUnsharp:
+		if err := checkRange("radius", op.Radius, 0, MaxUnsharpRadius); err != nil {
+			return err
+		}
+		if err := checkRange("amount", op.Amount, 0, MaxUnsharpAmount); err != nil {
+			return err
+		}
+		if err := checkRange("threshold", op.Threshold, 0, MaxThreshold); err != nil {
+			return err
+		}
+	case OpAdjust:
+		if err := checkRange("brightness", op.Brightness, -100, 100); err != nil {
+			return err
+		}
+		if err := checkRange("contrast", op.Contrast, -100, 100); err != nil {
+			return err
+		}
+		if op.Gamma != 0 {
+			if err := checkRange("gamma", op.Gamma, MinGamma, MaxGamma); err != nil {
+				return err
+			}
+		}
+		if err := checkRange("saturation", op.Saturation, -100, MaxSaturation); err != nil {
+			return err
+		}
+		if err := checkRange("hue", op.Hue, -180, 180); err != nil {
+			return err
+		}
+	case OpEffect:
+		if !knownEffects[op.Effect] {
+			return fmt.Errorf("unknown effect %q", op.Effect)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks every step of the output and its encode settings
+func (o OutputSpec) Validate() error {
+	if err := o.validateEncoding(); err != nil {
+		return err
+	}
+	for i, step := range o.Steps {
+		if step.Type == OpResponsive {
+			return fmt.Errorf("step %d: responsive is only supported as a top-level operation", i)
+		}
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateEncoding checks the encode settings that outputs and flat
+// operations share
+func (o OutputSpec) validateEncoding() error {
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100, got %d", o.Quality)
+	}
+	if o.Format != "" && !knownFormats[o.Format] {
+		return fmt.Errorf("unknown format %q", o.Format)
+	}
+	if err := checkColor("background", o.Background); err != nil {
+		return err
+	}
+	if o.Frame != nil && *o.Frame < 0 {
+		return fmt.Errorf("frame must not be negative, got %d", *o.Frame)
+	}
+	if o.Metadata != "" && !knownMetadataPolicies[o.Metadata] {
+		return fmt.Errorf("unknown metadata policy %q", o.Metadata)
+	}
+	if o.MaxBytes < 0 {
+		return fmt.Errorf("max_bytes must not be negative, got %d", o.MaxBytes)
+	}
+	if err := checkRange("min_ssim", o.MinSSIM, 0, 1); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate checks that the job options are supported
+func (o JobOptions) Validate() error {
+	switch o.Placeholder {
+	case "", PlaceholderBlurHash, PlaceholderThumbHash:
+	default:
+		return fmt.Errorf("unknown placeholder %q", o.Placeholder)
+	}
+	if o.PaletteSize < 0 || o.PaletteSize > MaxPaletteSize {
+		return fmt.Errorf("palette_size must be between 1 and %d, got %d", MaxPaletteSize, o.PaletteSize)
+	}
+	for _, group := range o.Metadata {
+		if !knownMetadataGroups[group] {
+			return fmt.Errorf("unknown metadata group %q", group)
+		}
+	}
+	return nil
+}
+
+// checkColor returns an error unless s is empty or a hex color in #rgb,
+// #rrggbb or #rrggbbaa form
+func checkColor(name, s string) error {
+	if s == "" {
+		return nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil || (len(hex) != 3 && len(hex) != 6 && len(hex) != 8) {
+		return fmt.Errorf("%s must be a hex color such as #ffffff, got %q", name, s)
+	}
+	return nil
+}
+
+// checkRange returns an error if v is outside [min, max]
+func checkRange(name string, v, min, max float64) error {
+	if v < min || v > max {
+		return fmt.Errorf("%s must be between %v and %v, got %v", name, min, max, v)
+	}
+	return nil
+}
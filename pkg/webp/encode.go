@@ -0,0 +1,152 @@
+// Package webp implements a pure Go encoder for lossless WebP (VP8L) images.
+//
+// The bitstream format is described at
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+package webp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// maxDimension is the largest width or height a VP8L image can describe
+const maxDimension = 1 << 14
+
+// VP8X feature flags
+const (
+	flagXMP  = 1 << 2
+	flagEXIF = 1 << 3
+	flagICC  = 1 << 5
+)
+
+// Options are the encoding parameters
+type Options struct {
+	EXIF []byte // EXIF metadata to embed, a TIFF structure
+	XMP  []byte // XMP packet to embed
+	ICC  []byte // ICC color profile to embed
+}
+
+// Encode writes the image to w as a lossless WebP file. A nil Options
+// writes no metadata.
+func Encode(w io.Writer, img image.Image, o *Options) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return fmt.Errorf("webp: invalid image size %dx%d", width, height)
+	}
+
+	pix, hasAlpha := toARGB(img)
+	payload := encodeVP8L(pix, width, height, hasAlpha)
+	image := chunk{fourCC: "VP8L", data: payload}
+
+	if o == nil || (len(o.EXIF) == 0 && len(o.XMP) == 0 && len(o.ICC) == 0) {
+		return writeRIFF(w, []chunk{image})
+	}
+
+	// Metadata needs the extended format, which starts with a VP8X header
+	// followed by the color profile, the image data and the other metadata.
+	// The alpha flag is left unset: the VP8L header already records alpha,
+	// and some decoders (including golang.org/x/image/webp) reject VP8L data
+	// when it is set.
+	var flags byte
+	chunks := []chunk{{}}
+	if len(o.ICC) > 0 {
+		flags |= flagICC
+		chunks = append(chunks, chunk{fourCC: "ICCP", data: o.ICC})
+	}
+	chunks = append(chunks, image)
+	if len(o.EXIF) > 0 {
+		flags |= flagEXIF
+		chunks = append(chunks, chunk{fourCC: "EXIF", data: o.EXIF})
+	}
+	if len(o.XMP) > 0 {
+		flags |= flagXMP
+		chunks = append(chunks, chunk{fourCC: "XMP ", data: o.XMP})
+	}
+	chunks[0] = chunk{fourCC: "VP8X", data: vp8xHeader(flags, width, height)}
+
+	return writeRIFF(w, chunks)
+}
+
+// vp8xHeader builds the VP8X chunk payload: the feature flags and the
+// canvas size minus one as 24-bit values
+func vp8xHeader(flags byte, width, height int) []byte {
+	w, h := width-1, height-1
+	return []byte{
+		flags, 0, 0, 0,
+		byte(w), byte(w >> 8), byte(w >> 16),
+		byte(h), byte(h >> 8), byte(h >> 16),
+	}
+}
+
+// chunk is a single RIFF chunk
+type chunk struct {
+	fourCC string
+	data   []byte
+}
+
+// writeRIFF wraps the chunks in a RIFF "WEBP" container, padding each chunk
+// to an even length
+func writeRIFF(w io.Writer, chunks []chunk) error {
+	size := 4 // "WEBP"
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+
+	header := make([]byte, 0, 12)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(size))
+	header = append(header, "WEBP"...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		chunkHeader := make([]byte, 0, 8)
+		chunkHeader = append(chunkHeader, c.fourCC...)
+		chunkHeader = binary.LittleEndian.AppendUint32(chunkHeader, uint32(len(c.data)))
+		if _, err := w.Write(chunkHeader); err != nil {
+			return err
+		}
+		if _, err := w.Write(c.data); err != nil {
+			return err
+		}
+		if len(c.data)&1 == 1 {
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// toARGB converts the image to packed 0xAARRGGBB pixels in row order and
+// reports whether any pixel is not fully opaque
+func toARGB(img image.Image) ([]uint32, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	pix := make([]uint32, 0, width*height)
+	hasAlpha := false
+
+	nrgba, isNRGBA := img.(*image.NRGBA)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var c color.NRGBA
+			if isNRGBA {
+				c = nrgba.NRGBAAt(x, y)
+			} else {
+				c = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			}
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+			pix = append(pix, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+
+	return pix, hasAlpha
+}
@@ -0,0 +1,265 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+// gradient returns an opaque image with smooth horizontal and vertical ramps
+func gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 7), uint8(y * 5), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+// translucent returns an image with varying alpha, including fully
+// transparent pixels that keep their color
+func translucent(w, h int) *image.NRGBA {
+	img := gradient(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Pix[img.PixOffset(x, y)+3] = uint8((x * y * 13) % 256)
+		}
+	}
+	return img
+}
+
+// noise returns an image of random colors, which leaves nothing to predict
+// or match
+func noise(w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng.Read(img.Pix)
+	return img
+}
+
+// skewed returns a w*h image of shuffled colors whose counts follow the
+// Fibonacci sequence, so the ideal prefix code is deeper than VP8L allows
+// and has to be limited. w*h should be a Fibonacci number minus one.
+func skewed(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	pix := make([]color.NRGBA, 0, w*h)
+	a, b := 1, 1
+	for i := 0; len(pix) < w*h; i++ {
+		c := color.NRGBA{uint8(i * 10), uint8(255 - i*10), uint8(i * 37), 255}
+		for n := 0; n < a && len(pix) < w*h; n++ {
+			pix = append(pix, c)
+		}
+		a, b = b, a+b
+	}
+	rng := rand.New(rand.NewSource(2))
+	rng.Shuffle(len(pix), func(i, j int) { pix[i], pix[j] = pix[j], pix[i] })
+	for i, c := range pix {
+		img.SetNRGBA(i%w, i/w, c)
+	}
+	return img
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"1x1", gradient(1, 1)},
+		{"1x1 transparent", image.NewNRGBA(image.Rect(0, 0, 1, 1))},
+		{"single row", gradient(37, 1)},
+		{"single column", gradient(1, 29)},
+		{"odd size", gradient(17, 23)},
+		{"larger than a tile", gradient(101, 67)},
+		{"alpha", translucent(33, 45)},
+		{"noise", noise(40, 30)},
+		{"skewed histogram", skewed(161, 110)},
+		{"uniform", image.NewNRGBA(image.Rect(0, 0, 64, 64))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.img, nil); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			decoded, err := xwebp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			assertSamePixels(t, tt.img, decoded)
+		})
+	}
+}
+
+func TestEncodeSubImage(t *testing.T) {
+	img := translucent(50, 50).SubImage(image.Rect(7, 11, 30, 40)).(*image.NRGBA)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := xwebp.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	assertSamePixels(t, img, decoded)
+}
+
+func TestEncodeInvalidSize(t *testing.T) {
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 0, 10),
+		image.Rect(0, 0, maxDimension+1, 1),
+	} {
+		if err := Encode(&bytes.Buffer{}, image.NewNRGBA(r), nil); err == nil {
+			t.Errorf("Encode of %v succeeded, want an error", r)
+		}
+	}
+}
+
+func TestEncodeMetadata(t *testing.T) {
+	img := translucent(19, 13)
+	o := &Options{
+		EXIF: []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00"), // odd length, padded
+		XMP:  []byte("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"/>"),
+		ICC:  []byte("not really a profile"),
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, o); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	data := buf.Bytes()
+
+	decoded, err := xwebp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	assertSamePixels(t, img, decoded)
+
+	cfg, err := xwebp.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	if cfg.Width != 19 || cfg.Height != 13 {
+		t.Errorf("canvas is %dx%d, want 19x13", cfg.Width, cfg.Height)
+	}
+
+	if got := binary.LittleEndian.Uint32(data[4:]); int(got) != len(data)-8 {
+		t.Errorf("RIFF size is %d, want %d", got, len(data)-8)
+	}
+	chunks := readChunks(t, data)
+	var order []string
+	for _, c := range chunks {
+		order = append(order, c.fourCC)
+	}
+	want := []string{"VP8X", "ICCP", "VP8L", "EXIF", "XMP "}
+	if len(order) != len(want) {
+		t.Fatalf("chunks are %q, want %q", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("chunks are %q, want %q", order, want)
+		}
+	}
+
+	if flags := chunks[0].data[0]; flags != flagICC|flagEXIF|flagXMP {
+		t.Errorf("VP8X flags are %#x, want %#x", flags, flagICC|flagEXIF|flagXMP)
+	}
+	for i, payload := range [][]byte{o.ICC, nil, o.EXIF, o.XMP} {
+		if payload != nil && !bytes.Equal(chunks[i+1].data, payload) {
+			t.Errorf("%s chunk is %q, want %q", chunks[i+1].fourCC, chunks[i+1].data, payload)
+		}
+	}
+}
+
+func TestEncodeNoMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, gradient(8, 8), &Options{}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	chunks := readChunks(t, buf.Bytes())
+	if len(chunks) != 1 || chunks[0].fourCC != "VP8L" {
+		t.Errorf("empty options wrote %d chunks, want a single VP8L chunk", len(chunks))
+	}
+}
+
+func TestBuildHuffmanCodeLimitsLength(t *testing.T) {
+	// Fibonacci frequencies give the deepest possible unrestricted tree
+	freqs := make([]uint32, 40)
+	a, b := uint32(1), uint32(1)
+	for i := range freqs {
+		freqs[i] = a
+		a, b = b, a+b
+	}
+
+	h := buildHuffmanCode(freqs, maxCodeLength)
+	kraft := 0.0
+	for s, l := range h.lengths {
+		if l == 0 || int(l) > maxCodeLength {
+			t.Fatalf("symbol %d has length %d, want 1 to %d", s, l, maxCodeLength)
+		}
+		kraft += 1 / float64(uint(1)<<l)
+	}
+	if kraft != 1 {
+		t.Errorf("code lengths have a Kraft sum of %v, want a complete code", kraft)
+	}
+}
+
+func TestBuildHuffmanCodeSingleSymbol(t *testing.T) {
+	h := buildHuffmanCode([]uint32{0, 0, 5, 0}, maxCodeLength)
+	used := 0
+	for _, l := range h.lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	if used != 2 || h.lengths[2] == 0 {
+		t.Errorf("lengths are %v, want two codes including symbol 2", h.lengths)
+	}
+}
+
+// readChunks splits a RIFF WEBP file into its chunks
+func readChunks(t *testing.T, data []byte) []chunk {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		t.Fatalf("missing RIFF WEBP header")
+	}
+	var chunks []chunk
+	for rest := data[12:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			t.Fatalf("truncated chunk header")
+		}
+		size := int(binary.LittleEndian.Uint32(rest[4:]))
+		if 8+size > len(rest) {
+			t.Fatalf("chunk %q is truncated", rest[:4])
+		}
+		chunks = append(chunks, chunk{fourCC: string(rest[:4]), data: rest[8 : 8+size]})
+		rest = rest[min(8+size+size&1, len(rest)):]
+	}
+	return chunks
+}
+
+// assertSamePixels fails unless the decoded image has exactly the pixels of
+// the original
+func assertSamePixels(t *testing.T, want *image.NRGBA, got image.Image) {
+	t.Helper()
+	wb, gb := want.Bounds(), got.Bounds()
+	if wb.Dx() != gb.Dx() || wb.Dy() != gb.Dy() {
+		t.Fatalf("decoded size is %v, want %v", gb.Size(), wb.Size())
+	}
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			w := want.NRGBAAt(wb.Min.X+x, wb.Min.Y+y)
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+			if w != g {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package webp
+
+import "container/heap"
+
+const (
+	// maxCodeLength is the longest prefix code VP8L allows
+	maxCodeLength = 15
+	// maxCodeLengthCodeLength is the longest code in the code-length code,
+	// whose lengths are stored in 3 bits
+	maxCodeLengthCodeLength = 7
+
+	numCodeLengthCodes   = 19
+	codeRepeatPrevious   = 16
+	codeRepeatZeroes     = 17
+	codeRepeatZeroesLong = 18
+)
+
+// codeLengthCodeOrder is the order in which code-length code lengths are stored
+var codeLengthCodeOrder = [numCodeLengthCodes]int{
+	17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// huffmanCode is a canonical prefix code
+type huffmanCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+// write emits the code for symbol. Codes are stored most significant bit
+// first, so the bits are reversed for the LSB-first writer.
+func (h huffmanCode) write(bw *bitWriter, symbol uint32) {
+	length := uint(h.lengths[symbol])
+	code := h.codes[symbol]
+	var reversed uint32
+	for i := uint(0); i < length; i++ {
+		reversed = reversed<<1 | (code>>i)&1
+	}
+	bw.writeBits(reversed, length)
+}
+
+// buildHuffmanCode builds a canonical prefix code for the frequencies with no
+// code longer than maxLength. At least two symbols always get a code so the
+// tree is complete, even when fewer symbols are used.
+func buildHuffmanCode(freqs []uint32, maxLength int) huffmanCode {
+	weights := make([]uint32, len(freqs))
+	copy(weights, freqs)
+
+	used := 0
+	for _, f := range weights {
+		if f > 0 {
+			used++
+		}
+	}
+	for s := 0; used < 2 && s < len(weights); s++ {
+		if weights[s] == 0 {
+			weights[s] = 1
+			used++
+		}
+	}
+
+	var lengths []uint8
+	for {
+		lengths = huffmanLengths(weights)
+		longest := uint8(0)
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if int(longest) <= maxLength {
+			break
+		}
+		// Flatten the distribution and retry until the tree is short enough
+		for s, f := range weights {
+			if f > 0 {
+				weights[s] = (f + 1) / 2
+			}
+		}
+	}
+
+	return huffmanCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// huffmanNode is a leaf or internal node while building a Huffman tree
+type huffmanNode struct {
+	weight      uint64
+	symbol      int
+	left, right int
+}
+
+// nodeHeap is a min-heap of node indices ordered by weight
+type nodeHeap struct {
+	nodes   []huffmanNode
+	indices []int
+}
+
+func (h *nodeHeap) Len() int { return len(h.indices) }
+func (h *nodeHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.indices[i]], h.nodes[h.indices[j]]
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	return h.indices[i] < h.indices[j]
+}
+func (h *nodeHeap) Swap(i, j int) { h.indices[i], h.indices[j] = h.indices[j], h.indices[i] }
+func (h *nodeHeap) Push(x any)    { h.indices = append(h.indices, x.(int)) }
+func (h *nodeHeap) Pop() any {
+	last := h.indices[len(h.indices)-1]
+	h.indices = h.indices[:len(h.indices)-1]
+	return last
+}
+
+// huffmanLengths computes unrestricted Huffman code lengths for the
+// non-zero weights
+func huffmanLengths(weights []uint32) []uint8 {
+	h := &nodeHeap{}
+	for s, w := range weights {
+		if w > 0 {
+			h.nodes = append(h.nodes, huffmanNode{weight: uint64(w), symbol: s, left: -1, right: -1})
+			h.indices = append(h.indices, len(h.nodes)-1)
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 1 {
+		a := heap.Pop(h).(int)
+		b := heap.Pop(h).(int)
+		h.nodes = append(h.nodes, huffmanNode{
+			weight: h.nodes[a].weight + h.nodes[b].weight,
+			symbol: -1,
+			left:   a,
+			right:  b,
+		})
+		heap.Push(h, len(h.nodes)-1)
+	}
+
+	lengths := make([]uint8, len(weights))
+	var walk func(n int, depth uint8)
+	walk = func(n int, depth uint8) {
+		node := h.nodes[n]
+		if node.symbol >= 0 {
+			lengths[node.symbol] = depth
+			return
+		}
+		walk(node.left, depth+1)
+		walk(node.right, depth+1)
+	}
+	walk(h.indices[0], 0)
+
+	return lengths
+}
+
+// canonicalCodes assigns canonical codes to the code lengths: shorter codes
+// first and, within a length, in symbol order
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+
+	var next [maxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l > 0 {
+			codes[s] = next[l]
+			next[l]++
+		}
+	}
+	return codes
+}
+
+// codeLengthToken is one symbol of the code-length code with its extra bits
+type codeLengthToken struct {
+	symbol    uint32
+	extra     uint32
+	extraBits uint
+}
+
+// tokenizeCodeLengths run-length encodes code lengths using the repeat
+// symbols 16 (previous non-zero length), 17 and 18 (zeroes)
+func tokenizeCodeLengths(lengths []uint8) []codeLengthToken {
+	var tokens []codeLengthToken
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := min(run, 138)
+					tokens = append(tokens, codeLengthToken{codeRepeatZeroesLong, uint32(n - 11), 7})
+					run -= n
+				} else {
+					n := min(run, 10)
+					tokens = append(tokens, codeLengthToken{codeRepeatZeroes, uint32(n - 3), 3})
+					run -= n
+				}
+			}
+			for ; run > 0; run-- {
+				tokens = append(tokens, codeLengthToken{symbol: 0})
+			}
+			continue
+		}
+
+		tokens = append(tokens, codeLengthToken{symbol: uint32(l)})
+		run--
+		for run >= 3 {
+			n := min(run, 6)
+			tokens = append(tokens, codeLengthToken{codeRepeatPrevious, uint32(n - 3), 2})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{symbol: uint32(l)})
+		}
+	}
+	return tokens
+}
+
+// writeHuffmanCode stores a prefix code as a "normal" code: its code lengths
+// compressed with a code-length code
+func writeHuffmanCode(bw *bitWriter, h huffmanCode) {
+	tokens := tokenizeCodeLengths(h.lengths)
+
+	freqs := make([]uint32, numCodeLengthCodes)
+	for _, t := range tokens {
+		freqs[t.symbol]++
+	}
+	lengthCode := buildHuffmanCode(freqs, maxCodeLengthCodeLength)
+
+	// Trailing unused code-length codes (in storage order) can be omitted
+	numCodes := numCodeLengthCodes
+	for numCodes > 4 && lengthCode.lengths[codeLengthCodeOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	bw.writeBits(0, 1) // normal code
+	bw.writeBits(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.writeBits(uint32(lengthCode.lengths[codeLengthCodeOrder[i]]), 3)
+	}
+	bw.writeBits(0, 1) // code lengths cover the whole alphabet
+
+	for _, t := range tokens {
+		lengthCode.write(bw, t.symbol)
+		if t.extraBits > 0 {
+			bw.writeBits(t.extra, t.extraBits)
+		}
+	}
+}
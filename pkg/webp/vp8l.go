@@ -0,0 +1,420 @@
+package webp
+
+import "math/bits"
+
+const (
+	vp8lSignature = 0x2f
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// predictorBits is the log-2 tile size of the predictor transform
+	predictorBits = 4
+	numPredictors = 14
+
+	numLiteralCodes  = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+
+	// distanceCodeOffset is added to linear distances so they skip the
+	// 120 short two-dimensional distance codes
+	distanceCodeOffset = 120
+
+	minMatch    = 3
+	maxMatch    = 4096
+	maxDistance = 1<<20 - distanceCodeOffset
+	hashBits    = 16
+	maxChain    = 32
+)
+
+// encodeVP8L encodes ARGB pixels as a VP8L bitstream using the subtract
+// green and predictor transforms followed by LZ77 and Huffman coding
+func encodeVP8L(pix []uint32, width, height int, hasAlpha bool) []byte {
+	bw := &bitWriter{}
+
+	bw.writeBits(vp8lSignature, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3) // version
+
+	argb := make([]uint32, len(pix))
+	copy(argb, pix)
+
+	// Subtract green transform
+	bw.writeBits(1, 1)
+	bw.writeBits(transformSubtractGreen, 2)
+	subtractGreen(argb)
+
+	// Predictor transform
+	bw.writeBits(1, 1)
+	bw.writeBits(transformPredictor, 2)
+	bw.writeBits(predictorBits-2, 3)
+	modes, tilesX, _ := choosePredictors(argb, width, height)
+	writeImageData(bw, modes, tilesX, false)
+	residuals := applyPredictors(argb, width, height, modes, tilesX)
+
+	// No more transforms
+	bw.writeBits(0, 1)
+
+	writeImageData(bw, residuals, width, true)
+
+	return bw.bytes()
+}
+
+// subtractGreen subtracts the green channel from red and blue in place
+func subtractGreen(pix []uint32) {
+	for i, p := range pix {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		pix[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// choosePredictors picks, for every tile, the predictor mode with the
+// smallest total residual. The modes are returned as a sub-image whose green
+// channel holds the mode.
+func choosePredictors(pix []uint32, width, height int) ([]uint32, int, int) {
+	tileSize := 1 << predictorBits
+	tilesX := (width + tileSize - 1) >> predictorBits
+	tilesY := (height + tileSize - 1) >> predictorBits
+	modes := make([]uint32, tilesX*tilesY)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			bestMode, bestCost := 0, -1
+			for mode := 0; mode < numPredictors; mode++ {
+				cost := 0
+				for y := ty * tileSize; y < min((ty+1)*tileSize, height); y++ {
+					for x := tx * tileSize; x < min((tx+1)*tileSize, width); x++ {
+						if x == 0 || y == 0 {
+							continue
+						}
+						i := y*width + x
+						cost += residualCost(subPixels(pix[i], predict(mode, pix, i, width)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(bestMode)<<8
+		}
+	}
+
+	return modes, tilesX, tilesY
+}
+
+// applyPredictors returns the residuals of every pixel against its
+// prediction. The first pixel is predicted as opaque black, the rest of the
+// first row from the left and the first column from the top.
+func applyPredictors(pix []uint32, width, height int, modes []uint32, tilesX int) []uint32 {
+	residuals := make([]uint32, len(pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = pix[i-1]
+			case x == 0:
+				pred = pix[i-width]
+			default:
+				mode := int(modes[(y>>predictorBits)*tilesX+x>>predictorBits]>>8) & 0xf
+				pred = predict(mode, pix, i, width)
+			}
+			residuals[i] = subPixels(pix[i], pred)
+		}
+	}
+	return residuals
+}
+
+// predict returns the prediction for pixel i (not on the top row or left
+// column) using one of the 14 VP8L predictor modes. For the rightmost column
+// the top-right neighbor is, per the specification, the leftmost pixel of
+// the current row, which is simply the next pixel in memory order.
+func predict(mode int, pix []uint32, i, width int) uint32 {
+	l := pix[i-1]
+	t := pix[i-width]
+	tl := pix[i-width-1]
+	tr := pix[i-width+1]
+
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPredictor(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return clampAddSubtractHalf(average2(l, t), tl)
+	}
+}
+
+// average2 returns the per-channel floor average of two pixels
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// selectPredictor returns whichever of the left or top pixel is closer to
+// the gradient estimate L + T - TL
+func selectPredictor(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		cl := int(l>>shift) & 0xff
+		ct := int(t>>shift) & 0xff
+		ctl := int(tl>>shift) & 0xff
+		pl += absInt(ct - ctl)
+		pt += absInt(cl - ctl)
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+// clampAddSubtractFull returns a + b - c per channel, clamped to [0, 255]
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		out |= uint32(clampByte(v)) << shift
+	}
+	return out
+}
+
+// clampAddSubtractHalf returns a + (a - b) / 2 per channel, clamped to [0, 255]
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		ca := int(a >> shift & 0xff)
+		cb := int(b >> shift & 0xff)
+		out |= uint32(clampByte(ca+(ca-cb)/2)) << shift
+	}
+	return out
+}
+
+// subPixels subtracts b from a per channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// residualCost estimates how expensive a residual is to code
+func residualCost(r uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += absInt(int(int8(r >> shift)))
+	}
+	return cost
+}
+
+// token is either a literal pixel or, when length is non-zero, an LZ77
+// backward reference
+type token struct {
+	argb     uint32
+	length   uint32
+	distance uint32
+}
+
+// findMatches greedily replaces repeated pixel runs with backward references
+func findMatches(pix []uint32) []token {
+	n := len(pix)
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+
+	hash := func(i int) uint32 {
+		return (pix[i]*0x1e35a7bd ^ pix[i+1]*0x9e3779b1) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	tokens := make([]token, 0, n)
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+		if i+1 < n {
+			limit := min(maxMatch, n-i)
+			chain := 0
+			for c := int(head[hash(i)]); c >= 0 && chain < maxChain && i-c <= maxDistance; c = int(prev[c]) {
+				length := 0
+				for length < limit && pix[c+length] == pix[i+length] {
+					length++
+				}
+				if length > bestLen {
+					bestLen, bestDist = length, i-c
+					if length == limit {
+						break
+					}
+				}
+				chain++
+			}
+		}
+
+		if bestLen >= minMatch {
+			tokens = append(tokens, token{length: uint32(bestLen), distance: uint32(bestDist)})
+			for j := i; j < i+bestLen; j++ {
+				insert(j)
+			}
+			i += bestLen
+			continue
+		}
+
+		tokens = append(tokens, token{argb: pix[i]})
+		insert(i)
+		i++
+	}
+
+	return tokens
+}
+
+// prefixEncode splits an LZ77 length or distance code into its prefix
+// symbol and extra bits
+func prefixEncode(v uint32) (symbol, extraBits, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := uint32(bits.Len32(d)) - 1
+	second := (d >> (h - 1)) & 1
+	extraBits = h - 1
+	return 2*h + second, extraBits, d & (1<<extraBits - 1)
+}
+
+// writeImageData writes an entropy-coded image: the color cache and meta
+// prefix flags, the five prefix codes and the coded pixels
+func writeImageData(bw *bitWriter, pix []uint32, width int, topLevel bool) {
+	bw.writeBits(0, 1) // no color cache
+	if topLevel {
+		bw.writeBits(0, 1) // a single prefix code group
+	}
+
+	tokens := findMatches(pix)
+
+	green := make([]uint32, numLiteralCodes+numLengthCodes)
+	red := make([]uint32, numLiteralCodes)
+	blue := make([]uint32, numLiteralCodes)
+	alpha := make([]uint32, numLiteralCodes)
+	distance := make([]uint32, numDistanceCodes)
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[(t.argb>>8)&0xff]++
+			red[(t.argb>>16)&0xff]++
+			blue[t.argb&0xff]++
+			alpha[t.argb>>24]++
+			continue
+		}
+		lengthSymbol, _, _ := prefixEncode(t.length)
+		distSymbol, _, _ := prefixEncode(t.distance + distanceCodeOffset)
+		green[numLiteralCodes+lengthSymbol]++
+		distance[distSymbol]++
+	}
+
+	codes := [5]huffmanCode{
+		buildHuffmanCode(green, maxCodeLength),
+		buildHuffmanCode(red, maxCodeLength),
+		buildHuffmanCode(blue, maxCodeLength),
+		buildHuffmanCode(alpha, maxCodeLength),
+		buildHuffmanCode(distance, maxCodeLength),
+	}
+	for _, c := range codes {
+		writeHuffmanCode(bw, c)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, (t.argb>>8)&0xff)
+			codes[1].write(bw, (t.argb>>16)&0xff)
+			codes[2].write(bw, t.argb&0xff)
+			codes[3].write(bw, t.argb>>24)
+			continue
+		}
+		symbol, extraBits, extra := prefixEncode(t.length)
+		codes[0].write(bw, numLiteralCodes+symbol)
+		bw.writeBits(extra, uint(extraBits))
+
+		symbol, extraBits, extra = prefixEncode(t.distance + distanceCodeOffset)
+		codes[4].write(bw, symbol)
+		bw.writeBits(extra, uint(extraBits))
+	}
+}
+
+// bitWriter packs values least significant bit first
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+// writeBits appends the low n bits of v (n <= 32)
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v&(1<<n-1)) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nBits -= 8
+	}
+}
+
+// bytes flushes any partial byte and returns the written data
+func (w *bitWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nBits = 0, 0
+	}
+	return w.buf
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func clampByte(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
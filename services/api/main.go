@@ -82,6 +82,8 @@ func handleCreateJob(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ImageURL   string                 `json:"image_url"`
 		Operations []types.ImageOperation `json:"operations"`
+		Outputs    []types.OutputSpec     `json:"outputs"`
+		Options    types.JobOptions       `json:"options"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -95,7 +97,7 @@ func handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Operations) == 0 {
+	if len(req.Operations) == 0 && len(req.Outputs) == 0 {
 		// Default operation: resize to 800x600
 		req.Operations = []types.ImageOperation{
 			{
@@ -109,6 +111,28 @@ func handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Validate operations
+	for i, op := range req.Operations {
+		if err := op.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid operation %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate options
+	if err := req.Options.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("invalid options: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Validate outputs
+	for i, spec := range req.Outputs {
+		if err := spec.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid output %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Generate job ID and create job
 	jobID := uuid.New().String()
 	now := time.Now()
@@ -117,7 +141,9 @@ func handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		Status:     types.StatusPending,
 		ImageURL:   req.ImageURL,
 		Operations: req.Operations,
+		Outputs:    req.Outputs,
 		CreatedAt:  now,
+		Options:    req.Options,
 	}
 
 	// Store initial status in Redis
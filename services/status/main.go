@@ -7,17 +7,22 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"event-driven-image-pipeline/pkg/phash"
+	"event-driven-image-pipeline/pkg/storage"
 	"event-driven-image-pipeline/pkg/types"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	rdb *redis.Client
-	ctx = context.Background()
+	rdb       *redis.Client
+	hashIndex *storage.HashIndex
+	ctx       = context.Background()
 )
 
 func main() {
@@ -29,6 +34,7 @@ func main() {
 	}
 
 	rdb = redis.NewClient(redisOpts)
+	hashIndex = storage.NewHashIndex(rdb)
 
 	// Test Redis connection with retry
 	if err := waitForRedis(); err != nil {
@@ -38,6 +44,7 @@ func main() {
 
 	// HTTP routes
 	http.HandleFunc("/jobs/", handleGetJob)
+	http.HandleFunc("/similar", handleSimilarHash)
 	http.HandleFunc("/health", handleHealth)
 
 	addr := getEnv("STATUS_ADDR", ":8001")
@@ -55,6 +62,10 @@ func handleGetJob(w http.ResponseWriter, r *http.Request) {
 
 	// Extract job ID from URL path
 	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) == 4 && pathParts[3] == "similar" {
+		handleSimilarJobs(w, r, pathParts[2])
+		return
+	}
 	if len(pathParts) != 3 {
 		http.Error(w, "invalid job ID", http.StatusBadRequest)
 		return
@@ -77,6 +88,96 @@ func handleGetJob(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(job)
 }
 
+// handleSimilarJobs lists the jobs whose perceptual hash is within
+// max_distance bits (default 10) of the given job's hash, closest first
+func handleSimilarJobs(w http.ResponseWriter, r *http.Request, jobID string) {
+	maxDistance, ok := parseMaxDistance(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := getJob(jobID)
+	if err != nil {
+		if err == redis.Nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to get job", http.StatusInternalServerError)
+		return
+	}
+	if job.PerceptualHash == "" {
+		http.Error(w, "job has no perceptual hash yet", http.StatusConflict)
+		return
+	}
+	hash, err := phash.Parse(job.PerceptualHash)
+	if err != nil {
+		http.Error(w, "failed to read perceptual hash", http.StatusInternalServerError)
+		return
+	}
+
+	matches, err := hashIndex.FindSimilar(ctx, hash, maxDistance)
+	if err != nil {
+		http.Error(w, "failed to search index", http.StatusInternalServerError)
+		return
+	}
+	matches = slices.DeleteFunc(matches, func(m types.SimilarJob) bool { return m.JobID == jobID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"job_id":          jobID,
+		"perceptual_hash": job.PerceptualHash,
+		"max_distance":    maxDistance,
+		"matches":         matches,
+	})
+}
+
+// handleSimilarHash lists the jobs whose perceptual hash is within
+// max_distance bits of the hash query parameter, so a client can check an
+// upload before submitting a job for it
+func handleSimilarHash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	maxDistance, ok := parseMaxDistance(w, r)
+	if !ok {
+		return
+	}
+	hash, err := phash.Parse(r.URL.Query().Get("hash"))
+	if err != nil {
+		http.Error(w, "hash must be 16 hex digits", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := hashIndex.FindSimilar(ctx, hash, maxDistance)
+	if err != nil {
+		http.Error(w, "failed to search index", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"perceptual_hash": phash.Format(hash),
+		"max_distance":    maxDistance,
+		"matches":         matches,
+	})
+}
+
+// parseMaxDistance reads the max_distance query parameter, writing an error
+// response and reporting false when it is invalid
+func parseMaxDistance(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("max_distance")
+	if v == "" {
+		return phash.DefaultMaxDistance, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > 64 {
+		http.Error(w, "max_distance must be between 0 and 64", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
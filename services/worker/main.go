@@ -16,8 +16,12 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// jobTTL is how long job state, and its hash index entry, is kept in Redis
+const jobTTL = 24 * time.Hour
+
 var (
 	rdb            *redis.Client
+	hashIndex      *storage.HashIndex
 	ctx            = context.Background()
 	rmqConn        *amqp.Connection
 	rmqChan        *amqp.Channel
@@ -65,8 +69,10 @@ func main() {
 		log.Fatal("Failed to create MinIO client:", err)
 	}
 
-	// Create image processor
+	// Create image processor, checking sources against the hash index
+	hashIndex = storage.NewHashIndex(rdb)
 	imageProcessor = processor.NewImageProcessor(minioClient.Client, minioClient.BucketName)
+	imageProcessor.SetSimilarFinder(hashIndex)
 
 	// Declare the jobs queue
 	_, err = rmqChan.QueueDeclare(
@@ -121,6 +127,7 @@ func main() {
 
 		// Save final job state
 		saveJob(job)
+		indexJob(job)
 		log.Printf("✅ Finished job: %s with %d results", job.ID, len(job.Results))
 	}
 }
@@ -158,11 +165,21 @@ func waitForRabbitMQ(url string) (*amqp.Connection, error) {
 // saveJob updates Redis with the job status
 func saveJob(job types.Job) {
 	data, _ := json.Marshal(job)
-	if err := rdb.Set(ctx, fmt.Sprintf("job:%s", job.ID), data, 24*time.Hour).Err(); err != nil {
+	if err := rdb.Set(ctx, fmt.Sprintf("job:%s", job.ID), data, jobTTL).Err(); err != nil {
 		log.Println("❌ Failed to save job to Redis:", err)
 	}
 }
 
+// indexJob records the job's perceptual hash for near-duplicate lookups
+func indexJob(job types.Job) {
+	if job.PerceptualHash == "" {
+		return
+	}
+	if err := hashIndex.Add(ctx, job, jobTTL); err != nil {
+		log.Println("❌ Failed to index job in Redis:", err)
+	}
+}
+
 func getEnv(key, fallback string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val